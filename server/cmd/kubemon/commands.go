@@ -0,0 +1,793 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"server/pkg/client"
+)
+
+func newFlags(name string, g *globals) *flag.FlagSet {
+	fs := flag.NewFlagSet("kubemon "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: kubemon %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	g.register(fs)
+	return fs
+}
+
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("o", "table", "output format: table, json or yaml")
+}
+
+func runLogin(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("login", g)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	// whoami needs no cluster, it says whether the server takes the
+	// credentials and who they belong to
+	id, err := c.WhoAmI(ctx)
+	if err != nil {
+		return fmt.Errorf("couldnt log in to %s: %w", g.server, err)
+	}
+	if id.Method == "anonymous" {
+		return fmt.Errorf("%s did not authenticate the request, log in with a client certificate it accepts (--cert, --key)", g.server)
+	}
+
+	if err := saveConfig(&cliConfig{Server: g.server, Token: g.token, Cert: abs(g.cert), Key: abs(g.key), CA: abs(g.ca)}); err != nil {
+		return err
+	}
+	fmt.Printf("logged in to %s as %s (%s)\n", g.server, id.User, id.Subject)
+	return nil
+}
+
+// abs is path made absolute so the saved login works from anywhere, empty
+// stays empty
+func abs(path string) string {
+	if path == "" {
+		return ""
+	}
+	if p, err := filepath.Abs(path); err == nil {
+		return p
+	}
+	return path
+}
+
+func runConnect(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("connect", g)
+	contextName := fs.String("context", "", "kubeconfig context, current-context when empty")
+	name := fs.String("name", "", "name to register the cluster under, the context name when empty")
+	labels := fs.String("labels", "", "cluster labels, e.g. env=prod,team=infra")
+	namespaces := fs.String("namespaces", "", "only show these namespaces, for credentials that can not list all of them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts := client.UploadOptions{Context: *contextName, Name: *name}
+	for _, ns := range strings.Split(*namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			opts.Namespaces = append(opts.Namespaces, ns)
+		}
+	}
+	if *labels != "" {
+		l, err := parseLabels(*labels)
+		if err != nil {
+			return err
+		}
+		opts.Labels = l
+	}
+
+	path := fs.Arg(0)
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, ".kube", "config")
+	}
+
+	kubeconfig, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.UploadKubeconfig(ctx, kubeconfig, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("connected using %s, context %s, registered as cluster %s\n", path, res.CurrentContext, res.Cluster)
+	return nil
+}
+
+func runContexts(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("contexts", g)
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.Context(ctx)
+	if err != nil {
+		return err
+	}
+
+	return p.print(res, func(w *tabwriter.Writer) {
+		row(w, "CURRENT", "NAME", "CLUSTER", "USER", "NAMESPACE", "SERVER")
+		for _, kc := range res.Contexts {
+			current, namespace := "", kc.Namespace
+			if kc.Name == res.CurrentContext {
+				current, namespace = "*", res.Namespace
+			}
+			row(w, current, kc.Name, kc.Cluster, kc.User, orNone(namespace), orNone(kc.Server))
+		}
+	})
+}
+
+func runUseContext(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("use-context", g)
+	namespace := fs.String("n", "", "default namespace, the context's own when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.UseContext(ctx, fs.Arg(0), *namespace)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("switched to context %s, namespace %s\n", res.CurrentContext, orNone(res.Namespace))
+	return nil
+}
+
+func runOverview(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("overview", g)
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ov, err := c.Overview(ctx)
+	if err != nil {
+		return err
+	}
+
+	return p.print(ov, func(w *tabwriter.Writer) {
+		for _, c := range ov.Collectors {
+			switch {
+			case c.Status != "ok":
+				fmt.Fprintf(w, "%s not loaded (%s): %s\n", c.Name, c.Status, c.Message)
+			case len(c.SkippedNamespaces) > 0:
+				fmt.Fprintf(w, "%s skipped in %s, no access\n", c.Name, strings.Join(c.SkippedNamespaces, ", "))
+			}
+		}
+		if ov.Nodes != nil {
+			fmt.Fprintf(w, "nodes ready: %d/%d\n\n", ov.Nodes.Running, ov.Nodes.Total)
+		}
+		if ov.Pods == nil {
+			return
+		}
+
+		row(w, "NAMESPACE", "PODS RUNNING", "CPU REQ", "MEM REQ", "NO REQUESTS", "SERVICES", "INGRESS", "SECRETS", "CONFIGMAPS")
+		for _, ns := range sortedKeys(ov.Pods.TotalPods) {
+			cpuReq, memReq, noReq := "-", "-", "-"
+			if r := ov.Pods.Resources[ns]; r != nil {
+				cpuReq, memReq = cpu(r.Requests.CPU), memory(r.Requests.Memory)
+				noReq = fmt.Sprintf("%d/%d", r.WithoutRequests, r.Containers)
+			}
+			row(w, ns,
+				fmt.Sprintf("%d/%d", ov.Pods.RunningPods[ns], ov.Pods.TotalPods[ns]),
+				cpuReq, memReq, noReq,
+				count(ov.Services != nil, func() int { return ov.Services.Totalservices[ns] }),
+				count(ov.Ingress != nil, func() int { return ov.Ingress.TotalIngress[ns] }),
+				count(ov.Secrets != nil, func() int { return ov.Secrets.TotalSecrets[ns] }),
+				count(ov.ConfigMaps != nil, func() int { return ov.ConfigMaps.Total[ns] }),
+			)
+		}
+	})
+}
+
+// count guards the per namespace lookups for parts of the overview that
+// might be missing
+func count(ok bool, n func() int) string {
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprint(n())
+}
+
+func runPods(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("pods", g)
+	output := outputFlag(fs)
+	namespace := fs.String("n", "", "only this namespace")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	pods, err := c.Pods(ctx)
+	if err != nil {
+		return err
+	}
+
+	list := make([]*client.PodsInfo, 0)
+	if pods != nil {
+		for _, pod := range pods.PodsList {
+			if *namespace == "" || pod.NameSpace == *namespace {
+				list = append(list, pod)
+			}
+		}
+	}
+
+	return p.print(list, func(w *tabwriter.Writer) {
+		row(w, "NAMESPACE", "NAME", "READY", "STATUS", "RESTARTS", "AGE", "IP", "NODE")
+		for _, pod := range list {
+			row(w, pod.NameSpace, pod.Name,
+				fmt.Sprintf("%d/%d", pod.ReadyContainer, pod.TotalContainer),
+				podStatus(pod), pod.Restarts, age(pod.Age), orNone(pod.IP), orNone(pod.Node))
+		}
+	})
+}
+
+// podStatus is the STATUS column, servers from before it was computed only
+// say whether the pod is ready
+func podStatus(pod *client.PodsInfo) string {
+	if pod.KubectlStatus != "" {
+		return pod.KubectlStatus
+	}
+	if pod.Status == "yay" {
+		return "Ready"
+	}
+	return "NotReady"
+}
+
+func runNodes(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("nodes", g)
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	nodes, err := c.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	list := make([]*client.Nodesinfo, 0)
+	if nodes != nil {
+		list = nodes.Nodes
+	}
+
+	return p.print(list, func(w *tabwriter.Writer) {
+		row(w, "NAME", "STATUS", "ROLES", "PODS", "CPU REQ", "CPU LIM", "MEM REQ", "MEM LIM", "OVERCOMMITTED", "AGE")
+		for _, n := range list {
+			status, roles := nodeStatus(n), orNone(n.Roles)
+			a := n.Allocation
+			if a == nil {
+				row(w, n.Name, status, roles, "-", "-", "-", "-", "-", "-", age(n.Age))
+				continue
+			}
+			row(w, n.Name, status, roles, a.Pods,
+				fmt.Sprintf("%s (%.0f%%)", cpu(a.Requests.CPU), a.Percent.Requests.CPU),
+				fmt.Sprintf("%s (%.0f%%)", cpu(a.Limits.CPU), a.Percent.Limits.CPU),
+				fmt.Sprintf("%s (%.0f%%)", memory(a.Requests.Memory), a.Percent.Requests.Memory),
+				fmt.Sprintf("%s (%.0f%%)", memory(a.Limits.Memory), a.Percent.Limits.Memory),
+				a.Overcommitted, age(n.Age))
+		}
+	})
+}
+
+// nodeStatus is the STATUS column of kubectl get nodes
+func nodeStatus(n *client.Nodesinfo) string {
+	status := "NotReady"
+	if n.Status == "yay" {
+		status = "Ready"
+	}
+	if n.Unschedulable {
+		status += ",SchedulingDisabled"
+	}
+	return status
+}
+
+func runNode(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("node", g)
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.NodePods(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return p.print(res, func(w *tabwriter.Writer) {
+		n := res.Node
+		row(w, "Name:", n.Name)
+		row(w, "Status:", nodeStatus(n))
+		row(w, "Roles:", orNone(n.Roles))
+		row(w, "Zone:", orNone(n.Zone))
+		row(w, "Region:", orNone(n.Region))
+		row(w, "Instance type:", orNone(n.InstanceType))
+		row(w, "Version:", n.Version)
+		row(w, "Age:", age(n.Age))
+		fmt.Fprintln(w)
+
+		row(w, "CONDITION", "STATUS", "REASON", "MESSAGE")
+		for _, cond := range n.Conditions {
+			row(w, cond.Type, cond.Status, orNone(cond.Reason), cond.Message)
+		}
+		fmt.Fprintln(w)
+
+		row(w, "TAINT", "EFFECT")
+		for _, t := range n.Taints {
+			taint := t.Key
+			if t.Value != "" {
+				taint += "=" + t.Value
+			}
+			row(w, taint, t.Effect)
+		}
+		if len(n.Taints) == 0 {
+			row(w, "<none>", "")
+		}
+		fmt.Fprintln(w)
+
+		row(w, "NAMESPACE", "POD", "STATUS", "CPU REQ", "CPU LIM", "MEM REQ", "MEM LIM", "AGE")
+		for _, pod := range res.Pods {
+			row(w, pod.NameSpace, pod.Name, podStatus(pod),
+				cpu(pod.Requests.CPU), cpu(pod.Limits.CPU),
+				memory(pod.Requests.Memory), memory(pod.Limits.Memory), age(pod.Age))
+		}
+	})
+}
+
+func runServices(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("svc", g)
+	output := outputFlag(fs)
+	namespace := fs.String("n", "", "only this namespace")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	svcs, err := c.Services(ctx)
+	if err != nil {
+		return err
+	}
+
+	list := make([]*client.ServiceInfo, 0)
+	if svcs != nil {
+		for _, svc := range svcs.ServiceList {
+			if *namespace == "" || svc.Namespace == *namespace {
+				list = append(list, svc)
+			}
+		}
+	}
+
+	return p.print(list, func(w *tabwriter.Writer) {
+		row(w, "NAMESPACE", "NAME", "TYPE", "CLUSTER-IP", "EXTERNAL-IP", "PORT(S)", "ENDPOINTS", "AGE")
+		for _, svc := range list {
+			ports := make([]string, 0, len(svc.Ports))
+			for _, port := range svc.Ports {
+				ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+			}
+			row(w, svc.Namespace, svc.Name, svc.Type,
+				orNone(strings.Join(svc.ClusterIP, ",")),
+				orNone(strings.Join(svc.ExternalIP, ",")),
+				orNone(strings.Join(ports, ",")), endpoints(svc), age(svc.Age))
+		}
+	})
+}
+
+// endpoints is ready/all of a service's endpoints, - when they are unknown
+func endpoints(svc *client.ServiceInfo) string {
+	if svc.Endpoints == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d", svc.Endpoints.Ready, svc.Endpoints.Ready+svc.Endpoints.NotReady)
+}
+
+func runIngress(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("ingress", g)
+	output := outputFlag(fs)
+	namespace := fs.String("n", "", "only this namespace")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	ing, err := c.Ingress(ctx)
+	if err != nil {
+		return err
+	}
+
+	list := make([]*client.IngressInfo, 0)
+	if ing != nil {
+		for _, i := range ing.IngressList {
+			if *namespace == "" || i.Namespace == *namespace {
+				list = append(list, i)
+			}
+		}
+	}
+
+	return p.print(list, func(w *tabwriter.Writer) {
+		row(w, "NAMESPACE", "NAME", "HOSTS", "ADDRESS", "AGE")
+		for _, i := range list {
+			row(w, i.Namespace, i.Name, orNone(strings.Join(i.Hosts, ",")), orNone(i.Address), age(i.Age))
+		}
+	})
+}
+
+func runSearch(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("search", g)
+	output := outputFlag(fs)
+	limit := fs.Int("limit", 50, "max results, 0 for all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.Search(ctx, strings.Join(fs.Args(), " "), *limit)
+	if err != nil {
+		return err
+	}
+
+	if res.Total > len(res.Results) {
+		fmt.Fprintf(os.Stderr, "showing %d of %d matches, raise --limit for more\n", len(res.Results), res.Total)
+	}
+
+	return p.print(res.Results, func(w *tabwriter.Writer) {
+		row(w, "KIND", "NAMESPACE", "NAME", "MATCHED", "SCORE")
+		for _, r := range res.Results {
+			row(w, r.Kind, orNone(r.Namespace), r.Name, fmt.Sprintf("%s: %s", r.Field, r.Match), r.Score)
+		}
+	})
+}
+
+func runLogs(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("logs", g)
+	namespace := fs.String("n", "default", "namespace of the pod")
+	container := fs.String("c", "", "container, needed when the pod has several")
+	follow := fs.Bool("f", false, "keep streaming new lines")
+	tail := fs.Int64("tail", 0, "only the last n lines")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	opts := client.LogOptions{Container: *container, Follow: *follow, TailLines: *tail}
+	return c.StreamLogs(ctx, *namespace, fs.Arg(0), opts, func(line string) error {
+		_, err := fmt.Println(line)
+		return err
+	})
+}
+
+func runRestart(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("restart", g)
+	namespace := fs.String("n", "default", "namespace of the pod")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	if err := c.RestartPod(ctx, *namespace, fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Printf("pod %s/%s restarted\n", *namespace, fs.Arg(0))
+	return nil
+}
+
+func runRefresh(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("refresh", g)
+	maxAge := fs.Duration("max-age", 0, "keep an overview loaded more recently than this")
+	kinds := fs.String("kind", "", "only these kinds, e.g. pods,services")
+	namespace := fs.String("n", "", "only this namespace")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	opts := client.RefreshOptions{MaxAge: *maxAge, Namespace: *namespace}
+	if *kinds != "" {
+		opts.Kinds = strings.Split(*kinds, ",")
+	}
+	res, err := c.Refresh(ctx, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s, generation %d\n", res.Message, res.Generation)
+	return nil
+}
+
+func parseLabels(v string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("label %q is not key=value", kv)
+		}
+		labels[k] = val
+	}
+	return labels, nil
+}
+
+// formatLabels prints labels sorted so the table is stable
+func formatLabels(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		parts = append(parts, k+"="+labels[k])
+	}
+	return orNone(strings.Join(parts, ","))
+}
+
+func runClusters(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("clusters", g)
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.Clusters(ctx)
+	if err != nil {
+		return err
+	}
+
+	return p.print(res, func(w *tabwriter.Writer) {
+		row(w, "CURRENT", "NAME", "CONTEXT", "SERVER", "LABELS", "NAMESPACES", "BREAKER", "LAST REFRESH")
+		for _, cl := range res.Clusters {
+			current := ""
+			if cl.Current {
+				current = "*"
+			}
+			namespaces := "all"
+			if len(cl.Namespaces) > 0 {
+				namespaces = strings.Join(cl.Namespaces, ",")
+			}
+			breaker := "<none>"
+			if cl.Breaker != nil {
+				breaker = cl.Breaker.State
+			}
+			row(w, current, cl.Name, orNone(cl.Context), cl.Server, formatLabels(cl.Labels), namespaces, breaker, refreshState(cl.LastRefresh))
+		}
+	})
+}
+
+func runStored(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("stored", g)
+	output := outputFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.StoredClusters(ctx)
+	if err != nil {
+		return err
+	}
+	if !res.Enabled && *output == "table" {
+		fmt.Println("the server does not save clusters, it has no master secret configured")
+		return nil
+	}
+
+	return p.print(res, func(w *tabwriter.Writer) {
+		row(w, "NAME", "CONNECTED", "KEY", "SAVED", "STATUS")
+		for _, sc := range res.Clusters {
+			status := "ok"
+			switch {
+			case sc.Error != "":
+				status = sc.Error
+			case sc.Stale:
+				status = "previous secret"
+			}
+			saved := "<unknown>"
+			if !sc.SavedAt.IsZero() {
+				saved = sc.SavedAt.Local().Format(time.DateTime)
+			}
+			row(w, sc.Name, strconv.FormatBool(sc.Connected), orNone(sc.KeyID), saved, status)
+		}
+	})
+}
+
+func runForget(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("forget", g)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	if err := c.ForgetStoredCluster(ctx, fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Printf("saved cluster %s forgotten\n", fs.Arg(0))
+	return nil
+}
+
+func refreshState(r *client.RefreshStatus) string {
+	switch {
+	case r == nil:
+		return "pending"
+	case r.Partial:
+		return r.At.Local().Format("15:04:05") + " partial: " + r.Error
+	case r.Error != "":
+		return "failed: " + r.Error
+	}
+	return r.At.Local().Format("15:04:05")
+}
+
+func runFleet(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("fleet", g)
+	output := outputFlag(fs)
+	selector := fs.String("l", "", "only clusters with these labels, e.g. env=prod")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	p, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.Fleet(ctx, *selector)
+	if err != nil {
+		return err
+	}
+
+	return p.print(res, func(w *tabwriter.Writer) {
+		t := res.Totals
+		fmt.Fprintf(w, "clusters healthy: %d/%d, nodes ready: %d/%d, pods running: %d/%d\n\n",
+			t.Healthy, t.Clusters, t.Nodes.Running, t.Nodes.Total, t.Pods.Running, t.Pods.Total)
+
+		row(w, "CLUSTER", "STATUS", "NODES READY", "PODS RUNNING", "LABELS")
+		for _, fc := range res.Clusters {
+			nodes, pods := "-", "-"
+			if fc.Nodes != nil {
+				nodes = fmt.Sprintf("%d/%d", fc.Nodes.Running, fc.Nodes.Total)
+			}
+			if fc.Pods != nil {
+				pods = fmt.Sprintf("%d/%d", fc.Pods.Running, fc.Pods.Total)
+			}
+			status := fc.Status
+			if fc.Error != "" {
+				status += ": " + fc.Error
+			}
+			row(w, fc.Name, status, nodes, pods, formatLabels(fc.Labels))
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// cliConfig is what `kubemon login` remembers between runs
+type cliConfig struct {
+	Server string `json:"server"`
+	Token  string `json:"token,omitempty"`
+	// paths of the client certificate login checked, not the files
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+	CA   string `json:"ca,omitempty"`
+}
+
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kubemon", "config.json"), nil
+}
+
+func loadConfig() (*cliConfig, error) {
+	cfg := &cliConfig{}
+
+	p, err := configPath()
+	if err != nil {
+		return cfg, nil
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func saveConfig(cfg *cliConfig) error {
+	p, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the token is a credential
+	return os.WriteFile(p, b, 0o600)
+}
@@ -0,0 +1,138 @@
+// kubemon is a terminal client for a running dashboard server.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"server/pkg/client"
+)
+
+// command is one kubemon subcommand, run gets the args after the name
+type command struct {
+	usage string
+	run   func(ctx context.Context, g *globals, args []string) error
+}
+
+var commands map[string]*command
+
+// filled in init since the commands look their own usage up in here
+func init() {
+	commands = map[string]*command{
+		"login":       {"login --server URL --cert FILE --key FILE [--ca FILE] [--token TOKEN]", runLogin},
+		"connect":     {"connect [--context NAME] [--name NAME] [--labels k=v,...] [--namespaces a,b] [KUBECONFIG]", runConnect},
+		"clusters":    {"clusters [-o table|json|yaml]", runClusters},
+		"fleet":       {"fleet [-l k=v,...] [-o table|json|yaml]", runFleet},
+		"stored":      {"stored [-o table|json|yaml]", runStored},
+		"forget":      {"forget NAME", runForget},
+		"contexts":    {"contexts [-o table|json|yaml]", runContexts},
+		"use-context": {"use-context [-n NAMESPACE] CONTEXT", runUseContext},
+		"overview":    {"overview [-o table|json|yaml]", runOverview},
+		"pods":        {"pods [-n NAMESPACE] [-o table|json|yaml]", runPods},
+		"nodes":       {"nodes [-o table|json|yaml]", runNodes},
+		"node":        {"node [-o table|json|yaml] NODE", runNode},
+		"svc":         {"svc [-n NAMESPACE] [-o table|json|yaml]", runServices},
+		"ingress":     {"ingress [-n NAMESPACE] [-o table|json|yaml]", runIngress},
+		"search":      {"search [-o table|json|yaml] QUERY", runSearch},
+		"logs":        {"logs -n NAMESPACE [-c CONTAINER] [-f] [--tail N] POD", runLogs},
+		"restart":     {"restart -n NAMESPACE POD", runRestart},
+		"refresh":     {"refresh [--max-age 30s] [--kind pods,services] [-n NAMESPACE]", runRefresh},
+		"tui":         {"tui [--interval 10s]", runTUI},
+	}
+}
+
+// globals are the flags every command accepts, they override the saved login
+type globals struct {
+	server  string
+	token   string
+	cluster string
+	// the client certificate the server knows users by, and the ca its own
+	// certificate is checked against
+	cert, key, ca string
+}
+
+func (g *globals) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.server, "server", g.server, "dashboard server url")
+	fs.StringVar(&g.token, "token", g.token, "bearer token for a proxy in front of the server, the server itself does not check it")
+	fs.StringVar(&g.cert, "cert", g.cert, "client certificate file to authenticate with")
+	fs.StringVar(&g.key, "key", g.key, "key file of the client certificate")
+	fs.StringVar(&g.ca, "ca", g.ca, "ca file to check the server's certificate against, the system roots when empty")
+	fs.StringVar(&g.cluster, "cluster", g.cluster, "registered cluster to use, the server's current one when empty")
+}
+
+func (g *globals) client() (*client.Client, error) {
+	if g.server == "" {
+		return nil, errors.New("no server set, run kubemon login --server URL first")
+	}
+	opts := []client.Option{client.WithToken(g.token), client.WithUserAgent("kubemon"), client.WithCluster(g.cluster)}
+	if g.cert != "" || g.key != "" {
+		opts = append(opts, client.WithClientCert(g.cert, g.key))
+	}
+	if g.ca != "" {
+		opts = append(opts, client.WithServerCA(g.ca))
+	}
+	return client.New(g.server, opts...)
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: kubemon COMMAND [flags]")
+	fmt.Fprintln(os.Stderr)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  kubemon %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "every command also takes --server, --cert, --key, --ca, --token and --cluster, KUBEMON_SERVER, KUBEMON_CERT, KUBEMON_KEY,")
+	fmt.Fprintln(os.Stderr, "KUBEMON_CA, KUBEMON_TOKEN and KUBEMON_CLUSTER work too")
+}
+
+func main() {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "kubemon: unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kubemon: reading config:", err)
+		os.Exit(1)
+	}
+	g := &globals{server: cfg.Server, token: cfg.Token, cert: cfg.Cert, key: cfg.Key, ca: cfg.CA}
+	for v, env := range map[*string]string{&g.server: "KUBEMON_SERVER", &g.token: "KUBEMON_TOKEN", &g.cert: "KUBEMON_CERT", &g.key: "KUBEMON_KEY", &g.ca: "KUBEMON_CA"} {
+		if s := os.Getenv(env); s != "" {
+			*v = s
+		}
+	}
+	g.cluster = os.Getenv("KUBEMON_CLUSTER")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = cmd.run(ctx, g, os.Args[2:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "kubemon:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// printer writes either the raw value as json/yaml or a table built by rows
+type printer struct {
+	format string
+	out    io.Writer
+}
+
+func newPrinter(format string) (*printer, error) {
+	switch format {
+	case "table", "json", "yaml":
+		return &printer{format: format, out: os.Stdout}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, want table, json or yaml", format)
+}
+
+// print writes v as json or yaml, or calls table for the table format
+func (p *printer) print(v interface{}, table func(w *tabwriter.Writer)) error {
+	switch p.format {
+	case "json":
+		enc := json.NewEncoder(p.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "yaml":
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = p.out.Write(b)
+		return err
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 4, 3, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+func row(w io.Writer, cols ...interface{}) {
+	s := make([]string, len(cols))
+	for i, c := range cols {
+		s[i] = fmt.Sprint(c)
+	}
+	fmt.Fprintln(w, strings.Join(s, "\t"))
+}
+
+// sortedKeys so the per namespace tables come out stable
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// age turns the hours the server reports into something kubectl like
+func age(hours string) string {
+	var h float64
+	if _, err := fmt.Sscan(hours, &h); err != nil {
+		return hours
+	}
+
+	switch {
+	case h < 1:
+		return fmt.Sprintf("%dm", int(h*60))
+	case h < 48:
+		return fmt.Sprintf("%dh", int(h))
+	}
+	return fmt.Sprintf("%dd", int(h/24))
+}
+
+// cpu prints millicores the way kubernetes quantities read, 250m or 2
+func cpu(m int64) string {
+	if m%1000 == 0 {
+		return fmt.Sprint(m / 1000)
+	}
+	return fmt.Sprintf("%dm", m)
+}
+
+// memory prints a size in the binary units of memory quantities
+func memory(n int64) string {
+	units := []string{"", "Ki", "Mi", "Gi", "Ti"}
+	i := 0
+	for n >= 1024 && n%1024 == 0 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d%s", n, units[i])
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+// windows has no SIGWINCH, the screen catches up on the next redraw
+func notifyResize(ch chan<- struct{}) func() {
+	return func() {}
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"server/pkg/client"
+
+	"golang.org/x/term"
+)
+
+// the tui is a small event loop: keys, refresh results and resizes come in
+// on channels and every event redraws the whole screen
+
+const (
+	escClear      = "\x1b[H\x1b[2J"
+	escAltScreen  = "\x1b[?1049h"
+	escMainScreen = "\x1b[?1049l"
+	escHideCursor = "\x1b[?25l"
+	escShowCursor = "\x1b[?25h"
+	escReverse    = "\x1b[7m"
+	escBold       = "\x1b[1m"
+	escDim        = "\x1b[2m"
+	escReset      = "\x1b[0m"
+)
+
+type key int
+
+const (
+	keyOther key = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyQuit
+	keyRefresh
+	keyRestart
+	keyYes
+	keyNo
+	keyPageUp
+	keyPageDown
+)
+
+type tab struct {
+	title string
+	// rows builds the table, the first row is the header. ref identifies the
+	// object on a row for actions, it is nil for tabs without any
+	rows func(d *tuiData) (rows [][]string, refs []*podRef)
+}
+
+type podRef struct {
+	namespace string
+	name      string
+}
+
+type tuiData struct {
+	overview *client.Overview
+	nodes    *client.Nodes
+	pods     *client.Pods
+	services *client.Services
+	ingress  *client.Ingress
+}
+
+type tuiState struct {
+	tabs    []*tab
+	current int
+	cursor  []int
+	offset  []int
+
+	data      *tuiData
+	fetching  bool
+	lastFetch time.Time
+	err       error
+
+	confirm *podRef // restart waiting for y/n
+	message string
+}
+
+func runTUI(ctx context.Context, g *globals, args []string) error {
+	fs := newFlags("tui", g)
+	interval := fs.Duration("interval", 10*time.Second, "how often to refresh")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("tui needs a terminal")
+	}
+
+	c, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	old, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, old)
+
+	fmt.Print(escAltScreen, escHideCursor)
+	defer fmt.Print(escShowCursor, escMainScreen)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys := make(chan key)
+	go readKeys(ctx, keys)
+
+	resized := make(chan struct{}, 1)
+	stopResize := notifyResize(resized)
+	defer stopResize()
+
+	st := &tuiState{tabs: tuiTabs(), data: &tuiData{}}
+	st.cursor = make([]int, len(st.tabs))
+	st.offset = make([]int, len(st.tabs))
+
+	fetched := make(chan fetchResult, 1)
+	fetch := func() {
+		if st.fetching {
+			return
+		}
+		st.fetching = true
+		go func() { fetched <- fetchAll(ctx, c) }()
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	restarted := make(chan error, 1)
+
+	fetch()
+	for {
+		st.render(fd)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-resized:
+		case <-ticker.C:
+			fetch()
+		case res := <-fetched:
+			st.fetching = false
+			st.err = res.err
+			if res.err == nil {
+				st.data = res.data
+				st.lastFetch = time.Now()
+			}
+		case err := <-restarted:
+			if err != nil {
+				st.message = "restart failed: " + err.Error()
+			}
+			fetch()
+		case k := <-keys:
+			if st.confirm != nil {
+				ref := st.confirm
+				st.confirm = nil
+				if k == keyYes {
+					st.message = fmt.Sprintf("restarting %s/%s", ref.namespace, ref.name)
+					go func() { restarted <- c.RestartPod(ctx, ref.namespace, ref.name) }()
+				} else {
+					st.message = ""
+				}
+				continue
+			}
+
+			switch k {
+			case keyQuit:
+				return nil
+			case keyRefresh:
+				fetch()
+			case keyLeft:
+				st.current = (st.current + len(st.tabs) - 1) % len(st.tabs)
+			case keyRight:
+				st.current = (st.current + 1) % len(st.tabs)
+			case keyUp:
+				st.move(-1)
+			case keyDown:
+				st.move(1)
+			case keyPageUp:
+				st.move(-10)
+			case keyPageDown:
+				st.move(10)
+			case keyRestart:
+				_, refs := st.tabs[st.current].rows(st.data)
+				if i := st.cursor[st.current]; i < len(refs) && refs[i] != nil {
+					st.confirm = refs[i]
+				}
+			}
+		}
+	}
+}
+
+type fetchResult struct {
+	data *tuiData
+	err  error
+}
+
+// fetchAll loads every view at once so the tabs never disagree
+func fetchAll(ctx context.Context, c *client.Client) fetchResult {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	d := &tuiData{}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var first error
+	run := func(f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f(); err != nil {
+				mu.Lock()
+				if first == nil {
+					first = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	run(func() (err error) { d.overview, err = c.Overview(ctx); return })
+	run(func() (err error) { d.nodes, err = c.Nodes(ctx); return })
+	run(func() (err error) { d.pods, err = c.Pods(ctx); return })
+	run(func() (err error) { d.services, err = c.Services(ctx); return })
+	run(func() (err error) { d.ingress, err = c.Ingress(ctx); return })
+	wg.Wait()
+
+	return fetchResult{data: d, err: first}
+}
+
+func (st *tuiState) move(n int) {
+	rows, _ := st.tabs[st.current].rows(st.data)
+	last := len(rows) - 2 // minus the header
+	c := st.cursor[st.current] + n
+	if c > last {
+		c = last
+	}
+	if c < 0 {
+		c = 0
+	}
+	st.cursor[st.current] = c
+}
+
+func (st *tuiState) render(fd int) {
+	width, height, err := term.GetSize(fd)
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+
+	var b strings.Builder
+	b.WriteString(escClear)
+
+	// tab bar
+	for i, t := range st.tabs {
+		if i == st.current {
+			b.WriteString(escReverse + " " + t.title + " " + escReset)
+		} else {
+			b.WriteString(" " + t.title + " ")
+		}
+	}
+	b.WriteString("\r\n")
+
+	// status line
+	status := "loading..."
+	if !st.lastFetch.IsZero() {
+		status = "updated " + st.lastFetch.Format("15:04:05")
+	}
+	if st.fetching {
+		status += " (refreshing)"
+	}
+	if st.err != nil {
+		status += " error: " + st.err.Error()
+	}
+	b.WriteString(escDim + clip(status, width) + escReset + "\r\n\r\n")
+
+	rows, _ := st.tabs[st.current].rows(st.data)
+	lines := tableLines(rows)
+
+	// header + rows below the three lines above and above the two at the bottom
+	visible := height - 6
+	if visible < 1 {
+		visible = 1
+	}
+
+	cur := st.cursor[st.current]
+	off := st.offset[st.current]
+	if cur < off {
+		off = cur
+	}
+	if cur >= off+visible {
+		off = cur - visible + 1
+	}
+	st.offset[st.current] = off
+
+	if len(lines) > 0 {
+		b.WriteString(escBold + clip(lines[0], width) + escReset + "\r\n")
+		body := lines[1:]
+		for i := off; i < len(body) && i < off+visible; i++ {
+			if i == cur {
+				b.WriteString(escReverse + clip(padRight(body[i], width), width) + escReset + "\r\n")
+			} else {
+				b.WriteString(clip(body[i], width) + "\r\n")
+			}
+		}
+	}
+
+	// footer
+	b.WriteString(fmt.Sprintf("\x1b[%d;1H", height))
+	switch {
+	case st.confirm != nil:
+		b.WriteString(escBold + fmt.Sprintf("restart pod %s/%s? (y/n)", st.confirm.namespace, st.confirm.name) + escReset)
+	case st.message != "":
+		b.WriteString(clip(st.message, width))
+	default:
+		b.WriteString(escDim + clip("←/→ tabs  ↑/↓ move  r refresh  x restart pod  q quit", width) + escReset)
+	}
+
+	os.Stdout.WriteString(b.String())
+}
+
+func tableLines(rows [][]string) []string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	for _, r := range rows {
+		fmt.Fprintln(w, strings.Join(r, "\t"))
+	}
+	w.Flush()
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+}
+
+func clip(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s
+}
+
+func padRight(s string, width int) string {
+	if n := len([]rune(s)); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+func tuiTabs() []*tab {
+	return []*tab{
+		{title: "Namespaces", rows: namespaceRows},
+		{title: "Nodes", rows: nodeRows},
+		{title: "Pods", rows: podRows},
+		{title: "Services", rows: serviceRows},
+		{title: "Ingress", rows: ingressRows},
+	}
+}
+
+func namespaceRows(d *tuiData) ([][]string, []*podRef) {
+	rows := [][]string{{"NAMESPACE", "PODS RUNNING", "SERVICES", "INGRESS"}}
+	ov := d.overview
+	if ov == nil || ov.Pods == nil {
+		return rows, nil
+	}
+	for _, ns := range sortedKeys(ov.Pods.TotalPods) {
+		rows = append(rows, []string{
+			ns,
+			fmt.Sprintf("%d/%d", ov.Pods.RunningPods[ns], ov.Pods.TotalPods[ns]),
+			count(ov.Services != nil, func() int { return ov.Services.Totalservices[ns] }),
+			count(ov.Ingress != nil, func() int { return ov.Ingress.TotalIngress[ns] }),
+		})
+	}
+	return rows, nil
+}
+
+func nodeRows(d *tuiData) ([][]string, []*podRef) {
+	rows := [][]string{{"NAME", "STATUS", "ROLES", "VERSION", "IP", "CPU", "MEMORY", "CPU REQ", "MEM REQ", "AGE"}}
+	if d.nodes == nil {
+		return rows, nil
+	}
+	for _, n := range d.nodes.Nodes {
+		status := nodeStatus(n)
+		cpuReq, memReq := "-", "-"
+		if a := n.Allocation; a != nil {
+			cpuReq, memReq = fmt.Sprintf("%.0f%%", a.Percent.Requests.CPU), fmt.Sprintf("%.0f%%", a.Percent.Requests.Memory)
+		}
+		rows = append(rows, []string{n.Name, status, orNone(n.Roles), n.Version, orNone(n.InternalIP), n.CPUcapacity, n.MemoryCapacity, cpuReq, memReq, age(n.Age)})
+	}
+	return rows, nil
+}
+
+func podRows(d *tuiData) ([][]string, []*podRef) {
+	rows := [][]string{{"NAMESPACE", "NAME", "READY", "STATUS", "RESTARTS", "AGE", "NODE"}}
+	var refs []*podRef
+	if d.pods == nil {
+		return rows, nil
+	}
+	for _, p := range d.pods.PodsList {
+		rows = append(rows, []string{
+			p.NameSpace, p.Name,
+			fmt.Sprintf("%d/%d", p.ReadyContainer, p.TotalContainer),
+			podStatus(p), fmt.Sprint(p.Restarts), age(p.Age), orNone(p.Node),
+		})
+		refs = append(refs, &podRef{namespace: p.NameSpace, name: p.Name})
+	}
+	return rows, refs
+}
+
+func serviceRows(d *tuiData) ([][]string, []*podRef) {
+	rows := [][]string{{"NAMESPACE", "NAME", "TYPE", "CLUSTER-IP", "ENDPOINTS", "AGE"}}
+	if d.services == nil {
+		return rows, nil
+	}
+	for _, s := range d.services.ServiceList {
+		rows = append(rows, []string{s.Namespace, s.Name, s.Type, orNone(strings.Join(s.ClusterIP, ",")), endpoints(s), age(s.Age)})
+	}
+	return rows, nil
+}
+
+func ingressRows(d *tuiData) ([][]string, []*podRef) {
+	rows := [][]string{{"NAMESPACE", "NAME", "HOSTS", "ADDRESS", "AGE"}}
+	if d.ingress == nil {
+		return rows, nil
+	}
+	for _, i := range d.ingress.IngressList {
+		rows = append(rows, []string{i.Namespace, i.Name, orNone(strings.Join(i.Hosts, ",")), orNone(i.Address), age(i.Age)})
+	}
+	return rows, nil
+}
+
+// readKeys decodes raw terminal input into keys until ctx is done
+func readKeys(ctx context.Context, keys chan<- key) {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+
+		k := decodeKey(buf[:n])
+		select {
+		case keys <- k:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func decodeKey(b []byte) key {
+	switch string(b) {
+	case "\x1b[A", "k":
+		return keyUp
+	case "\x1b[B", "j":
+		return keyDown
+	case "\x1b[D", "h", "\x1b[Z":
+		return keyLeft
+	case "\x1b[C", "l", "\t":
+		return keyRight
+	case "\x1b[5~":
+		return keyPageUp
+	case "\x1b[6~":
+		return keyPageDown
+	case "q", "\x03":
+		return keyQuit
+	case "r":
+		return keyRefresh
+	case "x":
+		return keyRestart
+	case "y", "Y":
+		return keyYes
+	case "n", "N", "\x1b":
+		return keyNo
+	}
+	return keyOther
+}
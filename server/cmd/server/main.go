@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"server/internal/config"
 	"server/internal/server"
 
 	"github.com/joho/godotenv"
@@ -12,29 +21,93 @@ import (
 
 func main() {
 	godotenv.Load()
-	x := os.Getenv("WITH_INGRESS")
 
-	s := server.CreateNewServer()
+	loader, err := config.NewLoader(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	mux := http.NewServeMux()
-	// mux.HandleFunc(fmt.Sprint("%s/yay", x), s.EncryptionHandler)
+	cfg, err := loader.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
 
-	mux.HandleFunc(fmt.Sprintf("%s/config", x), s.ConfigHandler)
-	// mux.HandleFunc("/test", s.TestHandler)
-	mux.HandleFunc(fmt.Sprintf("%s/overview", x), s.OverviewHandler)
+	s := server.CreateNewServer(cfg)
+	if err := s.OpenStore(); err != nil {
+		log.Fatalf("store: %v", err)
+	}
 
-	mux.HandleFunc(fmt.Sprintf("%s/pods", x), s.PodsHandler)
-	mux.HandleFunc(fmt.Sprintf("%s/nodes", x), s.NodesHandler)
-	mux.HandleFunc(fmt.Sprintf("%s/refresh", x), s.RefreshHandler)
-	mux.HandleFunc(fmt.Sprintf("%s/svc", x), s.SVCHandler)
-	mux.HandleFunc(fmt.Sprintf("%s/configmap", x), s.ConfigMapHandler)
-	// mux.HandleFunc(fmt.Sprintf("%s/delpod", x), s.DelPodHandler)
-	mux.HandleFunc(fmt.Sprintf("%s/restartpod", x), s.RestartPodHandler)
+	tc, reloader, err := tlsConfig(cfg)
+	if err != nil {
+		log.Fatalf("tls: %v", err)
+	}
 
-	mux.HandleFunc(fmt.Sprintf("%s/secrets", x), s.SecretsHandler)
-	mux.HandleFunc(fmt.Sprintf("%s/ingress", x), s.IngressHandler)
+	// background work runs until bg is cancelled, which only happens after
+	// the http server has drained so in-flight requests still see it
+	bg, stopBackground := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Go(func() { s.ConnectAtStartup(bg) })
+	wg.Go(func() { s.RestoreClusters(bg) })
+	wg.Go(func() { s.RunRefreshLoop(bg) })
+	wg.Go(func() { reloadOnSIGHUP(bg, loader, s) })
+	if reloader != nil {
+		wg.Go(func() { reloader.Watch(bg, 30*time.Second) })
+	}
 
-	fmt.Println("starting on :8082")
-	http.ListenAndServe(":8082", mux)
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           s.Routes(),
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader.D(),
+		ReadTimeout:       cfg.Timeouts.Read.D(),
+		WriteTimeout:      cfg.Timeouts.Write.D(),
+		IdleTimeout:       cfg.Timeouts.Idle.D(),
+		TLSConfig:         tc,
+	}
+	srv.RegisterOnShutdown(s.StopStreams)
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if tc != nil {
+			log.Printf("starting on %s (https)", cfg.Listen)
+			serveErr <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		log.Printf("starting on %s", cfg.Listen)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	// a second signal kills the process right away
+	stop()
+
+	timeout := cfg.Timeouts.Shutdown.D()
+	log.Printf("shutting down, waiting up to %s for requests to finish", timeout)
+
+	drain, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(drain); err != nil {
+		log.Printf("drain: %v, closing remaining connections", err)
+		srv.Close()
+	}
+
+	stopBackground()
+	wg.Wait()
+
+	if err := s.Close(); err != nil {
+		log.Printf("shutdown: %v", err)
+		os.Exit(1)
+	}
+	log.Printf("stopped")
 }
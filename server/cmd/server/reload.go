@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"server/internal/config"
+	"server/internal/server"
+)
+
+// reloadOnSIGHUP reads the config again on every SIGHUP until ctx is done. a
+// config that does not validate is logged and the running one is kept
+func reloadOnSIGHUP(ctx context.Context, loader *config.Loader, s *server.Server) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		cfg, err := loader.Load()
+		if err != nil {
+			log.Printf("config reload failed, keeping the current config:\n%v", err)
+			continue
+		}
+
+		ignored := s.ApplyConfig(cfg)
+		if len(ignored) > 0 {
+			log.Printf("config reloaded, changes to %s need a restart", strings.Join(ignored, ", "))
+		} else {
+			log.Printf("config reloaded")
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/tls"
+	"path/filepath"
+
+	"server/internal/certs"
+	"server/internal/config"
+)
+
+// tlsConfig builds the https settings, nil when tls is off. the returned
+// reloader has to be watched for certificate changes to be picked up
+func tlsConfig(cfg *config.Config) (*tls.Config, *certs.Reloader, error) {
+	t := cfg.TLS
+	if !t.Enabled() {
+		return nil, nil, nil
+	}
+
+	certFile, keyFile := t.CertFile, t.KeyFile
+	if t.SelfSigned {
+		hosts := append([]string{"localhost", "127.0.0.1", "::1"}, t.SelfSignedHosts...)
+		var err error
+		certFile, keyFile, err = certs.SelfSigned(filepath.Join(cfg.DataDir, "tls"), hosts)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tc := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if t.ClientCAFile != "" {
+		pool, err := certs.LoadCAPool(t.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+		if t.RequireClientCert {
+			tc.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return tc, reloader, nil
+}
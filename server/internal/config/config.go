@@ -0,0 +1,426 @@
+// Package config loads the server settings. later sources win:
+//
+//	defaults < config file < environment < flags
+//
+// the file is yaml, see Config for the keys. on SIGHUP the same sources are
+// read again and the settings that are safe to change live are applied
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+type Config struct {
+	Listen      string   `json:"listen"`
+	RoutePrefix string   `json:"routePrefix"`
+	CORSOrigins []string `json:"corsOrigins"`
+
+	// how often connected clusters are refreshed in the background, 0 only
+	// refreshes when asked to
+	RefreshInterval Duration `json:"refreshInterval"`
+	// kinds refreshed on an interval of their own, e.g. pods every 15s and
+	// nodes every 10m. a kind set to 0 is only refreshed when asked to
+	RefreshIntervals map[string]Duration `json:"refreshIntervals"`
+	// share of the interval a background refresh is moved by at random, so
+	// clusters and kinds do not all call their api servers at once
+	RefreshJitter float64 `json:"refreshJitter"`
+	// how old an overview the ui's /refresh route accepts before it
+	// collects again, every open tab polls it
+	RefreshMaxAge Duration `json:"refreshMaxAge"`
+
+	Timeouts Timeouts `json:"timeouts"`
+	// how the overview is listed from the clusters
+	Collection Collection `json:"collection"`
+	Features   Features   `json:"features"`
+	TLS        TLS        `json:"tls"`
+
+	// cluster to connect to at startup, an uploaded kubeconfig replaces it
+	Cluster Cluster `json:"cluster"`
+	// what uploaded kubeconfigs may contain
+	Uploads Uploads `json:"uploads"`
+
+	// where state that outlives the process is kept
+	DataDir string `json:"dataDir"`
+	// keeps uploaded clusters across restarts, encrypted under dataDir
+	Store Store `json:"store"`
+}
+
+// Kinds are the parts of an overview, each loaded by its own collector. they
+// key refreshIntervals
+var Kinds = []string{"namespaces", "nodes", "pods", "services", "ingress", "secrets", "configmaps"}
+
+type Timeouts struct {
+	ReadHeader Duration `json:"readHeader"`
+	Read       Duration `json:"read"`
+	// 0 by default, a write timeout would cut off followed log streams
+	Write Duration `json:"write"`
+	Idle  Duration `json:"idle"`
+	// how long in-flight requests get to finish on SIGTERM
+	Shutdown Duration `json:"shutdown"`
+}
+
+// Collection tunes how collectors list from the api server
+type Collection struct {
+	// cluster lists each kind once across all namespaces, namespaces lists
+	// every namespace on its own. auto lists cluster-wide when the
+	// credentials may and every namespace is shown
+	Strategy string `json:"strategy"` // auto, cluster or namespaces
+	// objects per list call, 0 lists everything in one response
+	PageSize int `json:"pageSize"`
+	// namespaces listed at once with the namespaces strategy
+	Workers int `json:"workers"`
+	// deadline for every single list call
+	CallTimeout Duration `json:"callTimeout"`
+
+	// retries of a call that may work on another try: timeouts, 429, 5xx
+	// and dropped connections
+	Retries int `json:"retries"`
+	// wait before the first retry, doubled for every further one with
+	// jitter and never longer than retryMaxBackoff. a Retry-After from the
+	// api server is honored when longer
+	RetryBackoff    Duration `json:"retryBackoff"`
+	RetryMaxBackoff Duration `json:"retryMaxBackoff"`
+	// consecutive failed calls after which a cluster's calls fail right
+	// away, 0 disables the breaker
+	BreakerThreshold int `json:"breakerThreshold"`
+	// how long an open breaker waits before letting a call through to see
+	// whether the cluster is back
+	BreakerCooldown Duration `json:"breakerCooldown"`
+}
+
+// TLS turns on https when a cert/key pair is given or selfSigned is set
+type TLS struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// dev mode, a certificate is generated into dataDir
+	SelfSigned bool `json:"selfSigned"`
+	// extra names for the generated certificate besides localhost
+	SelfSignedHosts []string `json:"selfSignedHosts"`
+
+	// ca bundle for client certificates, setting it enables mtls
+	ClientCAFile      string `json:"clientCAFile"`
+	RequireClientCert bool   `json:"requireClientCert"`
+	// client certificate subject to dashboard user. keys are either the
+	// common name or the full subject like "CN=alice,O=ops". when empty the
+	// common name is the user
+	ClientUsers map[string]string `json:"clientUsers"`
+}
+
+func (t *TLS) Enabled() bool {
+	return t.CertFile != "" || t.SelfSigned
+}
+
+// Cluster picks the startup connection. with nothing set the server waits for
+// a kubeconfig upload like before
+type Cluster struct {
+	// kubeconfig file, $KUBECONFIG is used when empty
+	Kubeconfig string `json:"kubeconfig"`
+	// context in the kubeconfig, current-context when empty
+	Context string `json:"context"`
+	// use the pod's service account. auto does when running in a pod and no
+	// kubeconfig is given
+	InCluster string `json:"inCluster"` // auto, true or false
+}
+
+// Uploads is the policy for kubeconfigs sent to the server. the startup
+// kubeconfig is the operator's own and is not checked
+type Uploads struct {
+	MaxSize int64 `json:"maxSize"` // bytes
+	// exec credential plugins that may run on the server, by command and
+	// arguments as written in the kubeconfig, e.g.
+	// "aws --region * eks get-token --cluster-name *" or
+	// /usr/local/bin/gke-gcloud-auth-plugin. * stands for any one argument,
+	// the arguments have to match in full. any other exec plugin, and any
+	// that sets environment variables, is rejected
+	AllowedExecCommands []string `json:"allowedExecCommands"`
+	// auth-provider plugins that may be used, e.g. oidc
+	AllowedAuthProviders []string `json:"allowedAuthProviders"`
+	// accept clusters with insecure-skip-tls-verify, they are warned about
+	AllowInsecureSkipTLSVerify bool `json:"allowInsecureSkipTLSVerify"`
+	// client certificates expiring within this are warned about
+	CertExpiryWarning Duration `json:"certExpiryWarning"`
+}
+
+// Store encrypts the saved clusters with keys derived from a master secret.
+// without a secret uploaded clusters only live in memory
+type Store struct {
+	// file holding the master secret, at least 32 bytes
+	SecretFile string `json:"secretFile"`
+	// secrets from before a rotation. clusters saved with one of them are
+	// read and saved again with the current secret on startup
+	PreviousSecretFiles []string `json:"previousSecretFiles"`
+}
+
+func (s *Store) Enabled() bool {
+	return s.SecretFile != ""
+}
+
+type Features struct {
+	Search      bool `json:"search"`
+	Logs        bool `json:"logs"`
+	RestartPods bool `json:"restartPods"`
+}
+
+func Default() *Config {
+	return &Config{
+		Listen:        ":8082",
+		CORSOrigins:   []string{"http://localhost:3000", "http://localhost:80"},
+		RefreshJitter: 0.1,
+		RefreshMaxAge: Duration(10 * time.Second),
+		Timeouts: Timeouts{
+			ReadHeader: Duration(10 * time.Second),
+			Idle:       Duration(2 * time.Minute),
+			Shutdown:   Duration(30 * time.Second),
+		},
+		Collection: Collection{
+			Strategy:    "auto",
+			PageSize:    500,
+			Workers:     8,
+			CallTimeout: Duration(30 * time.Second),
+
+			Retries:          3,
+			RetryBackoff:     Duration(200 * time.Millisecond),
+			RetryMaxBackoff:  Duration(5 * time.Second),
+			BreakerThreshold: 5,
+			BreakerCooldown:  Duration(30 * time.Second),
+		},
+		Features: Features{
+			Search:      true,
+			Logs:        true,
+			RestartPods: true,
+		},
+		Cluster: Cluster{InCluster: "auto"},
+		Uploads: Uploads{
+			MaxSize:           1 << 20,
+			CertExpiryWarning: Duration(30 * 24 * time.Hour),
+		},
+		DataDir: "data",
+	}
+}
+
+// Duration reads "30s" style strings from the file
+type Duration time.Duration
+
+func (d Duration) D() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Validate reports every problem at once so a bad file is fixed in one go
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("listen %q: %w", c.Listen, err))
+	}
+
+	if c.RoutePrefix != "" && (!strings.HasPrefix(c.RoutePrefix, "/") || strings.HasSuffix(c.RoutePrefix, "/")) {
+		errs = append(errs, fmt.Errorf("routePrefix %q must start with / and not end with one", c.RoutePrefix))
+	}
+
+	for _, o := range c.CORSOrigins {
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs = append(errs, fmt.Errorf("corsOrigins: %q is not an origin like https://host:port", o))
+		}
+	}
+
+	durations := map[string]Duration{
+		"refreshInterval":            c.RefreshInterval,
+		"refreshMaxAge":              c.RefreshMaxAge,
+		"timeouts.readHeader":        c.Timeouts.ReadHeader,
+		"timeouts.read":              c.Timeouts.Read,
+		"timeouts.write":             c.Timeouts.Write,
+		"timeouts.idle":              c.Timeouts.Idle,
+		"timeouts.shutdown":          c.Timeouts.Shutdown,
+		"collection.callTimeout":     c.Collection.CallTimeout,
+		"collection.retryBackoff":    c.Collection.RetryBackoff,
+		"collection.retryMaxBackoff": c.Collection.RetryMaxBackoff,
+		"collection.breakerCooldown": c.Collection.BreakerCooldown,
+		"uploads.certExpiryWarning":  c.Uploads.CertExpiryWarning,
+	}
+	for name, d := range durations {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s can not be negative", name))
+		}
+	}
+	if c.RefreshInterval > 0 && c.RefreshInterval.D() < time.Second {
+		errs = append(errs, fmt.Errorf("refreshInterval %s is below the 1s minimum", c.RefreshInterval))
+	}
+	for kind, d := range c.RefreshIntervals {
+		if !slices.Contains(Kinds, kind) {
+			errs = append(errs, fmt.Errorf("refreshIntervals: unknown kind %q, one of %s", kind, strings.Join(Kinds, ", ")))
+		} else if d < 0 || (d > 0 && d.D() < time.Second) {
+			errs = append(errs, fmt.Errorf("refreshIntervals.%s %s must be 0 or at least 1s", kind, d))
+		}
+	}
+	if c.RefreshJitter < 0 || c.RefreshJitter >= 1 {
+		errs = append(errs, fmt.Errorf("refreshJitter %g must be at least 0 and below 1", c.RefreshJitter))
+	}
+
+	if c.DataDir == "" {
+		errs = append(errs, errors.New("dataDir can not be empty"))
+	}
+
+	t := c.TLS
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		errs = append(errs, errors.New("tls.certFile and tls.keyFile go together"))
+	}
+	if t.CertFile != "" && t.SelfSigned {
+		errs = append(errs, errors.New("tls.selfSigned can not be combined with tls.certFile"))
+	}
+	if t.ClientCAFile != "" && !t.Enabled() {
+		errs = append(errs, errors.New("tls.clientCAFile needs tls.certFile or tls.selfSigned"))
+	}
+	if t.RequireClientCert && t.ClientCAFile == "" {
+		errs = append(errs, errors.New("tls.requireClientCert needs tls.clientCAFile"))
+	}
+	for _, f := range []string{t.CertFile, t.KeyFile, t.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			errs = append(errs, fmt.Errorf("tls: %w", err))
+		}
+	}
+
+	switch c.Collection.Strategy {
+	case "auto", "cluster", "namespaces":
+	default:
+		errs = append(errs, fmt.Errorf("collection.strategy %q must be auto, cluster or namespaces", c.Collection.Strategy))
+	}
+	if c.Collection.PageSize < 0 {
+		errs = append(errs, errors.New("collection.pageSize can not be negative"))
+	}
+	if c.Collection.Workers < 1 {
+		errs = append(errs, errors.New("collection.workers must be at least 1"))
+	}
+	if c.Collection.Retries < 0 || c.Collection.BreakerThreshold < 0 {
+		errs = append(errs, errors.New("collection.retries and collection.breakerThreshold can not be negative"))
+	}
+
+	if c.Uploads.MaxSize <= 0 {
+		errs = append(errs, errors.New("uploads.maxSize must be positive"))
+	}
+
+	if len(c.Store.PreviousSecretFiles) > 0 && !c.Store.Enabled() {
+		errs = append(errs, errors.New("store.previousSecretFiles needs store.secretFile"))
+	}
+	for _, f := range append([]string{c.Store.SecretFile}, c.Store.PreviousSecretFiles...) {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			errs = append(errs, fmt.Errorf("store: %w", err))
+		}
+	}
+
+	cl := c.Cluster
+	switch cl.InCluster {
+	case "auto", "false":
+	case "true":
+		if cl.Kubeconfig != "" || cl.Context != "" {
+			errs = append(errs, errors.New("cluster.inCluster can not be combined with cluster.kubeconfig or cluster.context"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("cluster.inCluster %q must be auto, true or false", cl.InCluster))
+	}
+	if cl.Kubeconfig != "" {
+		if _, err := os.Stat(cl.Kubeconfig); err != nil {
+			errs = append(errs, fmt.Errorf("cluster: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RestartRequired lists the settings that differ between c and next but only
+// take effect on a restart
+func (c *Config) RestartRequired(next *Config) []string {
+	var fields []string
+	if c.Listen != next.Listen {
+		fields = append(fields, "listen")
+	}
+	if c.RoutePrefix != next.RoutePrefix {
+		fields = append(fields, "routePrefix")
+	}
+	if !reflect.DeepEqual(c.Timeouts, next.Timeouts) {
+		fields = append(fields, "timeouts")
+	}
+	if c.DataDir != next.DataDir {
+		fields = append(fields, "dataDir")
+	}
+	if c.Cluster != next.Cluster {
+		fields = append(fields, "cluster")
+	}
+	if !reflect.DeepEqual(c.Store, next.Store) {
+		fields = append(fields, "store")
+	}
+	// the certificate files themselves are watched, only the users map is
+	// read per request
+	ct, nt := c.TLS, next.TLS
+	ct.ClientUsers, nt.ClientUsers = nil, nil
+	if !reflect.DeepEqual(ct, nt) {
+		fields = append(fields, "tls")
+	}
+	return fields
+}
+
+// Live returns a copy of next with the restart-only settings kept from c,
+// which is what a running server can actually switch to
+func (c *Config) Live(next *Config) *Config {
+	live := *next
+	live.Listen = c.Listen
+	live.RoutePrefix = c.RoutePrefix
+	live.Timeouts = c.Timeouts
+	live.DataDir = c.DataDir
+	live.Cluster = c.Cluster
+	live.Store = c.Store
+	users := next.TLS.ClientUsers
+	live.TLS = c.TLS
+	live.TLS.ClientUsers = users
+	return &live
+}
+
+func loadFile(c *Config, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// strict so typos in keys are errors instead of silently ignored
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
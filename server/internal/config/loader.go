@@ -0,0 +1,252 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is one value that can come from both the environment and a flag
+type setting struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool // flag can be given without a value
+	set    func(c *Config, v string) error
+}
+
+var settings = []setting{
+	stringSetting("listen", "KUBEMON_LISTEN", "address to listen on", func(c *Config) *string { return &c.Listen }),
+	stringSetting("route-prefix", "KUBEMON_ROUTE_PREFIX", "prefix for every route, e.g. when served behind an ingress path", func(c *Config) *string { return &c.RoutePrefix }),
+	{flag: "cors-origins", env: "KUBEMON_CORS_ORIGINS", usage: "comma separated origins allowed to call the api", set: func(c *Config, v string) error {
+		c.CORSOrigins = splitList(v)
+		return nil
+	}},
+	durationSetting("refresh-interval", "KUBEMON_REFRESH_INTERVAL", "background refresh interval, 0 disables", func(c *Config) *Duration { return &c.RefreshInterval }),
+	{flag: "refresh-intervals", env: "KUBEMON_REFRESH_INTERVALS", usage: "background refresh interval per kind, e.g. pods=15s,nodes=10m", set: setRefreshIntervals},
+	floatSetting("refresh-jitter", "KUBEMON_REFRESH_JITTER", "share of the interval background refreshes are moved by at random", func(c *Config) *float64 { return &c.RefreshJitter }),
+	durationSetting("refresh-max-age", "KUBEMON_REFRESH_MAX_AGE", "how old an overview the ui's /refresh accepts before collecting again", func(c *Config) *Duration { return &c.RefreshMaxAge }),
+	durationSetting("read-header-timeout", "KUBEMON_READ_HEADER_TIMEOUT", "http read header timeout", func(c *Config) *Duration { return &c.Timeouts.ReadHeader }),
+	durationSetting("read-timeout", "KUBEMON_READ_TIMEOUT", "http read timeout", func(c *Config) *Duration { return &c.Timeouts.Read }),
+	durationSetting("write-timeout", "KUBEMON_WRITE_TIMEOUT", "http write timeout, breaks followed logs when set", func(c *Config) *Duration { return &c.Timeouts.Write }),
+	durationSetting("idle-timeout", "KUBEMON_IDLE_TIMEOUT", "http keep-alive idle timeout", func(c *Config) *Duration { return &c.Timeouts.Idle }),
+	durationSetting("shutdown-timeout", "KUBEMON_SHUTDOWN_TIMEOUT", "how long in-flight requests get to finish on shutdown", func(c *Config) *Duration { return &c.Timeouts.Shutdown }),
+	stringSetting("collect-strategy", "KUBEMON_COLLECT_STRATEGY", "list each kind cluster-wide, per namespace or auto", func(c *Config) *string { return &c.Collection.Strategy }),
+	intSetting("collect-page-size", "KUBEMON_COLLECT_PAGE_SIZE", "objects per list call, 0 disables paging", func(c *Config) *int { return &c.Collection.PageSize }),
+	intSetting("collect-workers", "KUBEMON_COLLECT_WORKERS", "namespaces listed at once", func(c *Config) *int { return &c.Collection.Workers }),
+	intSetting("retries", "KUBEMON_RETRIES", "retries of failed calls to the cluster, 0 disables", func(c *Config) *int { return &c.Collection.Retries }),
+	intSetting("breaker-threshold", "KUBEMON_BREAKER_THRESHOLD", "failed calls in a row before a cluster is given a break, 0 disables", func(c *Config) *int { return &c.Collection.BreakerThreshold }),
+	durationSetting("breaker-cooldown", "KUBEMON_BREAKER_COOLDOWN", "how long calls to a failing cluster are skipped", func(c *Config) *Duration { return &c.Collection.BreakerCooldown }),
+	durationSetting("call-timeout", "KUBEMON_CALL_TIMEOUT", "deadline for every list call to the cluster", func(c *Config) *Duration { return &c.Collection.CallTimeout }),
+	{flag: "features", env: "KUBEMON_FEATURES", usage: "feature toggles, e.g. search=true,logs=false,restartPods=false", set: setFeatures},
+	stringSetting("tls-cert", "KUBEMON_TLS_CERT", "serving certificate, enables https", func(c *Config) *string { return &c.TLS.CertFile }),
+	stringSetting("tls-key", "KUBEMON_TLS_KEY", "key for the serving certificate", func(c *Config) *string { return &c.TLS.KeyFile }),
+	boolSetting("tls-self-signed", "KUBEMON_TLS_SELF_SIGNED", "serve https with a generated self signed certificate (dev)", func(c *Config) *bool { return &c.TLS.SelfSigned }),
+	stringSetting("tls-client-ca", "KUBEMON_TLS_CLIENT_CA", "ca bundle for client certificates, enables mtls", func(c *Config) *string { return &c.TLS.ClientCAFile }),
+	boolSetting("tls-require-client-cert", "KUBEMON_TLS_REQUIRE_CLIENT_CERT", "reject connections without a client certificate", func(c *Config) *bool { return &c.TLS.RequireClientCert }),
+	stringSetting("kubeconfig", "KUBEMON_KUBECONFIG", "kubeconfig to connect at startup, defaults to $KUBECONFIG", func(c *Config) *string { return &c.Cluster.Kubeconfig }),
+	stringSetting("kube-context", "KUBEMON_KUBE_CONTEXT", "kubeconfig context to connect at startup", func(c *Config) *string { return &c.Cluster.Context }),
+	stringSetting("in-cluster", "KUBEMON_IN_CLUSTER", "use the pod service account: auto, true or false", func(c *Config) *string { return &c.Cluster.InCluster }),
+	{flag: "allowed-exec-commands", env: "KUBEMON_ALLOWED_EXEC_COMMANDS", usage: "comma separated exec credential plugins uploaded kubeconfigs may use, command and arguments with * for any one argument", set: func(c *Config, v string) error {
+		c.Uploads.AllowedExecCommands = splitList(v)
+		return nil
+	}},
+	stringSetting("master-secret-file", "KUBEMON_MASTER_SECRET_FILE", "secret the saved clusters are encrypted with, enables saving them", func(c *Config) *string { return &c.Store.SecretFile }),
+	{flag: "previous-master-secret-files", env: "KUBEMON_PREVIOUS_MASTER_SECRET_FILES", usage: "comma separated secrets from before a rotation", set: func(c *Config, v string) error {
+		c.Store.PreviousSecretFiles = splitList(v)
+		return nil
+	}},
+	stringSetting("data-dir", "KUBEMON_DATA_DIR", "directory for persisted state", func(c *Config) *string { return &c.DataDir }),
+}
+
+func stringSetting(flag, env, usage string, field func(c *Config) *string) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func durationSetting(flag, env, usage string, field func(c *Config) *Duration) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = Duration(d)
+		return nil
+	}}
+}
+
+func intSetting(flag, env, usage string, field func(c *Config) *int) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func floatSetting(flag, env, usage string, field func(c *Config) *float64) setting {
+	return setting{flag: flag, env: env, usage: usage, set: func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}}
+}
+
+func boolSetting(flag, env, usage string, field func(c *Config) *bool) setting {
+	return setting{flag: flag, env: env, usage: usage, isBool: true, set: func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+// setRefreshIntervals replaces the intervals from the file, the kinds are
+// checked by Validate
+func setRefreshIntervals(c *Config, v string) error {
+	intervals := make(map[string]Duration)
+	for _, kv := range splitList(v) {
+		kind, val, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("%q is not kind=interval", kv)
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("%s: %w", kind, err)
+		}
+		intervals[kind] = Duration(d)
+	}
+	c.RefreshIntervals = intervals
+	return nil
+}
+
+func setFeatures(c *Config, v string) error {
+	toggles := map[string]*bool{
+		"search":      &c.Features.Search,
+		"logs":        &c.Features.Logs,
+		"restartPods": &c.Features.RestartPods,
+	}
+
+	for _, kv := range splitList(v) {
+		name, val, _ := strings.Cut(kv, "=")
+		t, ok := toggles[name]
+		if !ok {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+		on := true
+		if val != "" {
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("feature %s: %w", name, err)
+			}
+			on = b
+		}
+		*t = on
+	}
+	return nil
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Loader remembers where the config came from so it can be read again on
+// reload with the same file and flags
+type Loader struct {
+	path  string
+	flags map[string]string // flags given on the command line
+}
+
+// NewLoader parses the server flags out of args
+func NewLoader(name string, args []string) (*Loader, error) {
+	l := &Loader{flags: make(map[string]string)}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&l.path, "config", os.Getenv("KUBEMON_CONFIG"), "path to a yaml config file (KUBEMON_CONFIG)")
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s (%s)", s.usage, s.env)
+		if s.isBool {
+			fs.BoolFunc(s.flag, usage, func(v string) error {
+				l.flags[s.flag] = v
+				return nil
+			})
+			continue
+		}
+		fs.Func(s.flag, usage, func(v string) error {
+			l.flags[s.flag] = v
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	return l, nil
+}
+
+// Load builds and validates a fresh config from all sources
+func (l *Loader) Load() (*Config, error) {
+	c := Default()
+
+	if l.path != "" {
+		if err := loadFile(c, l.path); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+
+	// the variables from before there was a config file
+	if v, ok := os.LookupEnv("WITH_INGRESS"); ok {
+		c.RoutePrefix = v
+	}
+	if v := os.Getenv("CLIENT_IP"); v != "" {
+		c.CORSOrigins = append(c.CORSOrigins, v)
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(c, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := l.flags[s.flag]; ok {
+			if err := s.set(c, v); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.flag, err))
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	authv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// most developers only have namespace level rbac, so before listing anything
+// the cluster is asked what the credentials may list and the collectors skip
+// the rest instead of failing on it
+
+// accessTTL is how long the answers are reused, rbac rarely changes between
+// two refreshes
+const accessTTL = 5 * time.Minute
+
+// kindResources are the resources behind each collector
+var kindResources = map[string]authv1.ResourceAttributes{
+	"nodes":      {Resource: "nodes"},
+	"pods":       {Resource: "pods"},
+	"services":   {Resource: "services"},
+	"ingress":    {Group: "networking.k8s.io", Resource: "ingresses"},
+	"secrets":    {Resource: "secrets"},
+	"configmaps": {Resource: "configmaps"},
+}
+
+// kindAccess is where one kind may be listed
+type kindAccess struct {
+	allowed []string // namespaces, unused for nodes
+	skipped []string
+	// everywhere, for nodes the only thing that matters
+	all bool
+}
+
+type accessCache struct {
+	key   string // namespaces it was checked for
+	at    time.Time
+	kinds map[string]*kindAccess
+}
+
+// access is where each kind may be listed among namespaces, cached for
+// accessTTL per set of namespaces
+func (cl *Cluster) access(ctx context.Context, namespaces []string) map[string]*kindAccess {
+	key := strings.Join(namespaces, ",")
+	cl.mu.Lock()
+	cached := cl.accessCache
+	cl.mu.Unlock()
+	if cached != nil && cached.key == key && time.Since(cached.at) < accessTTL {
+		return cached.kinds
+	}
+
+	// cluster-wide access first, only the kinds denied there are reviewed
+	// per namespace
+	kinds := make(map[string]*kindAccess, len(kindResources))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for kind, res := range kindResources {
+		wg.Go(func() {
+			ka := &kindAccess{}
+			if cl.allowed(ctx, "", res) {
+				ka = &kindAccess{all: true, allowed: namespaces}
+			}
+			mu.Lock()
+			kinds[kind] = ka
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	var scoped []string
+	for kind, ka := range kinds {
+		if !ka.all && kind != "nodes" {
+			scoped = append(scoped, kind)
+		}
+	}
+	slices.Sort(scoped)
+
+	// one rules review per namespace answers for every kind at once, run on
+	// the same bounded pool as the lists
+	if len(scoped) > 0 {
+		allowed := make([][]bool, len(namespaces))
+		jobs := make(chan int)
+		for range min(cl.collection().Workers, len(namespaces)) {
+			wg.Go(func() {
+				for i := range jobs {
+					allowed[i] = cl.namespaceAccess(ctx, namespaces[i], scoped)
+				}
+			})
+		}
+		for i := range namespaces {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		for i, ns := range namespaces {
+			for j, kind := range scoped {
+				ka := kinds[kind]
+				if allowed[i][j] {
+					ka.allowed = append(ka.allowed, ns)
+				} else {
+					ka.skipped = append(ka.skipped, ns)
+				}
+			}
+		}
+	}
+
+	cl.mu.Lock()
+	cl.accessCache = &accessCache{key: key, at: time.Now(), kinds: kinds}
+	cl.mu.Unlock()
+	return kinds
+}
+
+// namespaceAccess is whether each of kinds may be listed in ns, from a rules
+// review or one access review per kind when the rules are incomplete
+func (cl *Cluster) namespaceAccess(ctx context.Context, ns string, kinds []string) []bool {
+	rules, ok := cl.rules(ctx, ns)
+	allowed := make([]bool, len(kinds))
+	for i, kind := range kinds {
+		res := kindResources[kind]
+		if ok {
+			allowed[i] = rulesAllow(rules, res)
+		} else {
+			allowed[i] = cl.allowed(ctx, ns, res)
+		}
+	}
+	return allowed
+}
+
+// allowed asks whether res may be listed in ns, all namespaces when ns is
+// empty. when the review itself fails the list is tried anyway and its error
+// reported like before
+func (cl *Cluster) allowed(ctx context.Context, ns string, res authv1.ResourceAttributes) bool {
+	res.Namespace = ns
+	res.Verb = "list"
+	review := &authv1.SelfSubjectAccessReview{Spec: authv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &res}}
+	var r *authv1.SelfSubjectAccessReview
+	err := cl.call(ctx, func(ctx context.Context) (err error) {
+		r, err = cl.ClientSet.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return true
+	}
+	return r.Status.Allowed
+}
+
+// rules are the resource rules the credentials have in ns, ok is false when
+// the cluster could not give a complete answer
+func (cl *Cluster) rules(ctx context.Context, ns string) ([]authv1.ResourceRule, bool) {
+	review := &authv1.SelfSubjectRulesReview{Spec: authv1.SelfSubjectRulesReviewSpec{Namespace: ns}}
+	var r *authv1.SelfSubjectRulesReview
+	err := cl.call(ctx, func(ctx context.Context) (err error) {
+		r, err = cl.ClientSet.AuthorizationV1().SelfSubjectRulesReviews().Create(ctx, review, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil || r.Status.Incomplete {
+		return nil, false
+	}
+	return r.Status.ResourceRules, true
+}
+
+// rulesAllow reports whether one of rules lets every object of res be listed
+func rulesAllow(rules []authv1.ResourceRule, res authv1.ResourceAttributes) bool {
+	matches := func(values []string, v string) bool {
+		return slices.Contains(values, v) || slices.Contains(values, "*")
+	}
+	for _, r := range rules {
+		if len(r.ResourceNames) > 0 {
+			continue
+		}
+		if matches(r.Verbs, "list") && matches(r.APIGroups, res.Group) && matches(r.Resources, res.Resource) {
+			return true
+		}
+	}
+	return false
+}
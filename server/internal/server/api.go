@@ -0,0 +1,314 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// everything under /api/v1 answers with these types, the legacy routes keep
+// their old map shaped bodies so the ui doesnt break
+
+type APIError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type ErrorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// RefreshResponse says whether a refresh collected anything, it does not
+// when the overview was younger than the maxAge asked for
+type RefreshResponse struct {
+	Message    string `json:"message"`
+	Refreshed  bool   `json:"refreshed"`
+	Generation uint64 `json:"generation"`
+}
+
+type NodeCounts struct {
+	Total   int `json:"total"`
+	Running int `json:"running"`
+}
+
+type OverviewResponse struct {
+	Nodes      *NodeCounts `json:"nodes"`
+	Pods       *Pods       `json:"pods"`
+	Namespaces *NameSpace  `json:"namespaces"`
+	Services   *Services   `json:"services"`
+	Ingress    *Ingress    `json:"ingress"`
+	Secrets    *Secrets    `json:"secrets"`
+	ConfigMaps *ConfigMaps `json:"configmaps"`
+	// the parts that failed to load keep what loaded before, null when they
+	// never did, and are flagged here
+	Collectors []*CollectorStatus `json:"collectors"`
+	Access     *Access            `json:"access"`
+	// the snapshot the response was read from, it goes up with every
+	// refresh that stored an overview
+	Generation uint64 `json:"generation"`
+}
+
+type PodsResponse struct {
+	Pods       *Pods  `json:"pods"`
+	Generation uint64 `json:"generation"`
+}
+
+type NodesResponse struct {
+	Nodes      *Nodes `json:"nodes"`
+	Generation uint64 `json:"generation"`
+}
+
+// NodePodsResponse is one node and the pods scheduled on it, finished pods
+// included though they do not count towards its allocation
+type NodePodsResponse struct {
+	Node       *Nodesinfo  `json:"node"`
+	Pods       []*PodsInfo `json:"pods"`
+	Generation uint64      `json:"generation"`
+}
+
+type ServicesResponse struct {
+	Services   *Services `json:"services"`
+	Generation uint64    `json:"generation"`
+}
+
+type IngressResponse struct {
+	Ingress    *Ingress `json:"ingress"`
+	Generation uint64   `json:"generation"`
+}
+
+type SecretsResponse struct {
+	Secrets    *Secrets `json:"secrets"`
+	Generation uint64   `json:"generation"`
+}
+
+type ConfigMapsResponse struct {
+	ConfigMaps *ConfigMaps `json:"configmaps"`
+	Generation uint64      `json:"generation"`
+}
+
+type SearchResponse struct {
+	Query string `json:"query"`
+	// every match, results stops at the limit
+	Total      int             `json:"total"`
+	Results    []*SearchResult `json:"results"`
+	Generation uint64          `json:"generation"`
+}
+
+// ConfigUpload is the multipart form for POST /config, either the file or
+// the pasted contents
+type ConfigUpload struct {
+	File   string `json:"file" format:"binary"`
+	Pasted string `json:"pasted"`
+	// context to connect with, the kubeconfig's current-context when empty
+	Context   string `json:"context"`
+	Namespace string `json:"namespace"`
+	// cluster name to register under, defaults to the context name
+	Name   string `json:"name"`
+	Labels string `json:"labels"` // env=prod,team=infra
+	// comma separated namespaces to stick to, see ClusterRegistration
+	Namespaces string `json:"namespaces"`
+}
+
+// KubeconfigContext is one context of the kubeconfig the server is using
+type KubeconfigContext struct {
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	User      string `json:"user"`
+	Namespace string `json:"namespace,omitempty"`
+	Server    string `json:"server,omitempty"`
+}
+
+// KubeconfigResponse lists what is in the kubeconfig and which context and
+// default namespace are in use
+type KubeconfigResponse struct {
+	Message        string `json:"message,omitempty"`
+	Cluster        string `json:"cluster"`
+	CurrentContext string `json:"currentContext"`
+	Namespace      string `json:"namespace"`
+	// policy warnings about the context in use, uploads only
+	Warnings []*ValidationIssue   `json:"warnings,omitempty"`
+	Contexts []*KubeconfigContext `json:"contexts"`
+	Clusters []string             `json:"clusters"`
+	Users    []string             `json:"users"`
+}
+
+// ContextSwitch is the body of PUT /context, an empty namespace takes the
+// one set on the context
+type ContextSwitch struct {
+	Context   string `json:"context"`
+	Namespace string `json:"namespace"`
+}
+
+// ClusterRegistration is the body of POST /clusters, registering another
+// context of a kubeconfig the server already has
+type ClusterRegistration struct {
+	Name      string            `json:"name"` // defaults to the context name
+	Labels    map[string]string `json:"labels"`
+	Context   string            `json:"context"`
+	Namespace string            `json:"namespace"`
+	// the only namespaces to show, for credentials that may not list every
+	// namespace. all of them when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// registered cluster whose kubeconfig to take the context from, the
+	// current one when empty
+	From string `json:"from"`
+}
+
+type ClusterInfo struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels"`
+	Current     bool              `json:"current"`
+	Context     string            `json:"context,omitempty"`
+	Namespaces  []string          `json:"namespaces,omitempty"`
+	Server      string            `json:"server"`
+	LastRefresh *RefreshStatus    `json:"lastRefresh,omitempty"`
+	Breaker     *BreakerStatus    `json:"breaker"`
+}
+
+type ClustersResponse struct {
+	Current  string         `json:"current"`
+	Clusters []*ClusterInfo `json:"clusters"`
+}
+
+// StoredCluster is a saved cluster as found on disk. stale ones were saved
+// with a previous secret, the ones with an error can not be read back
+type StoredCluster struct {
+	Name      string    `json:"name"`
+	KeyID     string    `json:"keyId,omitempty"`
+	SavedAt   time.Time `json:"savedAt"`
+	Stale     bool      `json:"stale,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Connected bool      `json:"connected"`
+}
+
+// StoredClustersResponse lists the saved clusters, enabled is false when no
+// master secret is configured and nothing gets saved
+type StoredClustersResponse struct {
+	Enabled  bool             `json:"enabled"`
+	KeyID    string           `json:"keyId,omitempty"`
+	Clusters []*StoredCluster `json:"clusters"`
+}
+
+type PodCounts struct {
+	Total   int `json:"total"`
+	Running int `json:"running"`
+}
+
+// FleetCluster is one cluster's counts in the fleet view. status is ok,
+// degraded when some collectors of the snapshot failed, error when all of
+// them did or the first refresh failed, or pending before the first one
+type FleetCluster struct {
+	Name        string                `json:"name"`
+	Labels      map[string]string     `json:"labels"`
+	Status      string                `json:"status"`
+	Error       string                `json:"error,omitempty"`
+	LastRefresh *RefreshStatus        `json:"lastRefresh,omitempty"`
+	Breaker     *BreakerStatus        `json:"breaker"`
+	Nodes       *NodeCounts           `json:"nodes,omitempty"`
+	Pods        *PodCounts            `json:"pods,omitempty"`
+	Namespaces  map[string]*PodCounts `json:"namespaces,omitempty"`
+}
+
+type FleetTotals struct {
+	Clusters int        `json:"clusters"`
+	Healthy  int        `json:"healthy"`
+	Nodes    NodeCounts `json:"nodes"`
+	Pods     PodCounts  `json:"pods"`
+}
+
+type FleetResponse struct {
+	Totals   *FleetTotals    `json:"totals"`
+	Clusters []*FleetCluster `json:"clusters"`
+}
+
+// readJSON decodes a json request body into v, errors come back as 400s
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return newHTTPError(http.StatusBadRequest, "invalid request body: %s", err.Error())
+	}
+	return nil
+}
+
+// httpError carries the status code an error should be answered with
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func newHTTPError(status int, format string, args ...interface{}) error {
+	return &httpError{status: status, msg: fmt.Sprintf(format, args...)}
+}
+
+// statusOf returns the status attached to err, 500 if there isnt one
+func statusOf(err error) int {
+	var he *httpError
+	if errors.As(err, &he) {
+		return he.status
+	}
+	var ie *invalidKubeconfigError
+	if errors.As(err, &ie) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, &ErrorResponse{Error: &APIError{
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	}})
+}
+
+// writeErr answers with the status carried by err. rejected kubeconfigs get
+// their validation report along
+func writeErr(w http.ResponseWriter, err error) {
+	var ie *invalidKubeconfigError
+	if errors.As(err, &ie) {
+		status := statusOf(err)
+		writeJSON(w, status, &InvalidKubeconfigResponse{
+			Error:      &APIError{Status: status, Message: err.Error()},
+			Validation: ie.report,
+		})
+		return
+	}
+	writeError(w, statusOf(err), "%s", err.Error())
+}
+
+// kubeStatus maps an error from the kubernetes api onto the status we answer
+// with, anything unexpected is a bad gateway since the cluster is upstream
+func kubeStatus(err error) int {
+	var open *circuitOpenError
+	switch {
+	case errors.As(err, &open):
+		return http.StatusServiceUnavailable
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case apierrors.IsForbidden(err):
+		return http.StatusForbidden
+	case apierrors.IsUnauthorized(err):
+		return http.StatusUnauthorized
+	case apierrors.IsBadRequest(err), apierrors.IsInvalid(err):
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"server/internal/config"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Cluster is one registered cluster with its own client and cached overview.
+// the connection fields never change, switching context registers a new
+// Cluster under the same name
+type Cluster struct {
+	Name   string
+	Labels map[string]string
+	// namespaces to stick to, for credentials that can not list every
+	// namespace. empty means all of them
+	Namespaces []string
+
+	ClientSet  kubernetes.Interface
+	RestConfig *rest.Config
+	kubeconfig *kubeconfig // nil when connected in-cluster
+	// the server's config, set on register so collection settings reload
+	settings func() *config.Config
+	breaker  *breaker
+
+	// the current snapshot, swapped whole by refreshes and read without
+	// locking
+	snapshot atomic.Pointer[Snapshot]
+
+	mu          sync.Mutex
+	refreshing  map[string]*refreshCall // by kinds, "" for all
+	attempted   map[string]time.Time    // last refresh started per kind
+	lastRefresh *RefreshStatus          // the last one across namespaces
+	accessCache *accessCache
+}
+
+// RefreshStatus is how an overview refresh went. partial means some
+// collectors failed and error names them, the rest of the overview loaded
+type RefreshStatus struct {
+	At         time.Time `json:"at"`
+	DurationMs int64     `json:"durationMs"`
+	Error      string    `json:"error,omitempty"`
+	Partial    bool      `json:"partial,omitempty"`
+	// the kinds refreshed, empty when it was all of them, and the one
+	// namespace they were refreshed in if it was narrowed down to one
+	Kinds     []string `json:"kinds,omitempty"`
+	Namespace string   `json:"namespace,omitempty"`
+	// the snapshot generation the refresh stored, 0 when it stored none
+	Generation uint64 `json:"generation,omitempty"`
+}
+
+func newCluster(name string, labels map[string]string, c *rest.Config, kc *kubeconfig) (*Cluster, error) {
+	cs, err := NewClientSet(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Cluster{Name: name, Labels: labels, ClientSet: cs, RestConfig: c, kubeconfig: kc, breaker: newBreaker()}, nil
+}
+
+// LastRefresh is how the last refresh across namespaces went, nil before
+// the first. refreshes of one namespace are not recorded
+func (cl *Cluster) LastRefresh() *RefreshStatus {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.lastRefresh
+}
+
+// Cluster returns the registered cluster called name, the current one when
+// name is empty, or nil
+func (s *Server) Cluster(name string) *Cluster {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		name = s.current
+	}
+	return s.clusters[name]
+}
+
+// Clusters returns every registered cluster sorted by name
+func (s *Server) Clusters() []*Cluster {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]*Cluster, 0, len(s.clusters))
+	for _, cl := range s.clusters {
+		list = append(list, cl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// register adds cl, replacing a cluster with the same name. the first cluster
+// becomes the current one, later ones only when makeCurrent is set
+func (s *Server) register(cl *Cluster, makeCurrent bool) {
+	cl.settings = s.Config
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusters[cl.Name] = cl
+	if makeCurrent || s.current == "" {
+		s.current = cl.Name
+	}
+	s.wakeRefreshLoop()
+}
+
+// RemoveCluster forgets a cluster, reports false when there was none by that
+// name. removing the current one makes the first remaining cluster current
+func (s *Server) RemoveCluster(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clusters[name]; !ok {
+		return false
+	}
+	delete(s.clusters, name)
+
+	if s.current == name {
+		s.current = ""
+		names := make([]string, 0, len(s.clusters))
+		for n := range s.clusters {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) > 0 {
+			s.current = names[0]
+		}
+	}
+	return true
+}
+
+func (s *Server) currentName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// selectCluster picks the cluster a request is about from ?cluster=, answering
+// 404 for unknown names and 503 when nothing is connected yet
+func (s *Server) selectCluster(w http.ResponseWriter, r *http.Request) (*Cluster, bool) {
+	name := r.URL.Query().Get("cluster")
+	cl := s.Cluster(name)
+	if cl != nil {
+		return cl, true
+	}
+	if name != "" {
+		writeError(w, http.StatusNotFound, "no cluster named %q", name)
+	} else {
+		writeError(w, http.StatusServiceUnavailable, "no cluster connected")
+	}
+	return nil, false
+}
+
+var clusterNameRE = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]{0,61}[a-z0-9])?$`)
+
+func validClusterName(name string) error {
+	if !clusterNameRE.MatchString(name) {
+		return newHTTPError(http.StatusBadRequest, "cluster name %q must be lowercase letters, digits, '.', '_' or '-', at most 63 long", name)
+	}
+	return nil
+}
+
+// defaultClusterName turns a context name like arn:aws:eks:...:cluster/prod
+// into something usable as a cluster name
+func defaultClusterName(contextName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, contextName)
+	name = strings.Trim(name, "-._")
+	if len(name) > 63 {
+		name = strings.Trim(name[len(name)-63:], "-._")
+	}
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+// splitNames reads a comma separated list like "team-a,team-b"
+func splitNames(v string) []string {
+	var names []string
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// parseLabels reads "env=prod,team=infra"
+func parseLabels(v string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(v, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, val, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, newHTTPError(http.StatusBadRequest, "label %q is not key=value", kv)
+		}
+		labels[strings.TrimSpace(k)] = strings.TrimSpace(val)
+	}
+	return labels, nil
+}
+
+// matchesLabels reports whether labels has every key=value of selector
+func matchesLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"server/internal/config"
+
+	authv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// errNoCluster means the config names no cluster to start with
+var errNoCluster = errors.New("no startup cluster configured")
+
+// connect tests cl against its cluster, registers it and loads the first
+// overview. a failed refresh leaves it registered for the refresh loop
+func (s *Server) connect(ctx context.Context, cl *Cluster, makeCurrent bool) error {
+	// any authenticated user may ask what they are allowed to do, unlike
+	// listing namespaces which namespace scoped credentials can not
+	review := &authv1.SelfSubjectAccessReview{Spec: authv1.SelfSubjectAccessReviewSpec{
+		ResourceAttributes: &authv1.ResourceAttributes{Verb: "list", Resource: "namespaces"},
+	}}
+	err := cl.call(ctx, func(ctx context.Context) error {
+		_, err := cl.ClientSet.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return newHTTPError(http.StatusUnauthorized, "error connecting to cluster %s", err.Error())
+	}
+
+	s.register(cl, makeCurrent)
+	return cl.Refresh(ctx)
+}
+
+// startupRestConfig resolves the cluster settings to a rest config and says
+// where it came from for the logs. the kubeconfig is nil in-cluster
+func startupRestConfig(cl config.Cluster) (*rest.Config, *kubeconfig, string, error) {
+	kubeconfigEnv := os.Getenv("KUBECONFIG")
+	inPod := os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+
+	useInCluster := cl.InCluster == "true" ||
+		(cl.InCluster == "auto" && inPod && cl.Kubeconfig == "" && kubeconfigEnv == "")
+	if useInCluster {
+		c, err := rest.InClusterConfig()
+		return c, nil, "in-cluster service account", err
+	}
+
+	if cl.Kubeconfig == "" && kubeconfigEnv == "" {
+		return nil, nil, "", errNoCluster
+	}
+
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: cl.Kubeconfig}
+	source := cl.Kubeconfig
+	if cl.Kubeconfig == "" {
+		rules.Precedence = filepath.SplitList(kubeconfigEnv)
+		source = kubeconfigEnv
+	}
+	if cl.Context != "" {
+		source += " context " + cl.Context
+	}
+
+	cc := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: cl.Context})
+	c, err := cc.ClientConfig()
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	// kept so the context can be switched later like with an upload
+	raw, err := cc.RawConfig()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	contextName, err := resolveContext(&raw, cl.Context)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	namespace, _, err := cc.Namespace()
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	return c, &kubeconfig{raw: &raw, context: contextName, namespace: namespace}, source, nil
+}
+
+// ConnectAtStartup registers the configured cluster, see connectWithRetry.
+// without a configured cluster it returns right away
+func (s *Server) ConnectAtStartup(ctx context.Context) {
+	c, kc, source, err := startupRestConfig(s.Config().Cluster)
+	if errors.Is(err, errNoCluster) {
+		return
+	}
+	if err != nil {
+		log.Printf("startup cluster: %v", err)
+		return
+	}
+
+	name := "in-cluster"
+	if kc != nil {
+		name = defaultClusterName(kc.context)
+	}
+	cl, err := newCluster(name, nil, c, kc)
+	if err != nil {
+		log.Printf("startup cluster: %v", err)
+		return
+	}
+
+	s.connectWithRetry(ctx, cl, source)
+}
+
+// connectWithRetry connects cl, retrying with backoff until it works, ctx is
+// done or a cluster of the same name is registered in the meantime
+func (s *Server) connectWithRetry(ctx context.Context, cl *Cluster, source string) {
+	name := cl.Name
+	wait := time.Second
+	for {
+		err := s.connect(ctx, cl, false)
+		if err == nil {
+			log.Printf("connected to %s as cluster %s", source, name)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if s.Cluster(name) != nil {
+			// connected, the refresh loop retries the overview from here
+			log.Printf("connected to %s, first refresh failed: %v", source, err)
+			return
+		}
+		log.Printf("connecting to %s: %v, retrying in %s", source, err, wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if s.Cluster(name) != nil {
+			// registered by an upload in the meantime
+			return
+		}
+		wait = min(wait*2, time.Minute)
+	}
+}
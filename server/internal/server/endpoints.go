@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// a service whose selector matches nothing ready still gets its cluster ip,
+// only the endpoint slices tell whether anything answers behind it
+
+// ServiceEndpoints are the backends the endpoint slices of a service list.
+// a service with no ready ones drops every connection
+type ServiceEndpoints struct {
+	Ready     int         `json:"ready"`
+	NotReady  int         `json:"notready"`
+	Addresses []*Endpoint `json:"addresses"`
+}
+
+// Endpoint is one backend, terminating ones may still be serving while they
+// drain
+type Endpoint struct {
+	IP          string `json:"ip"`
+	Ready       bool   `json:"ready"`
+	Serving     bool   `json:"serving"`
+	Terminating bool   `json:"terminating"`
+	Node        string `json:"node,omitempty"`
+	Pod         string `json:"pod,omitempty"`
+}
+
+// getEndpointSlices lists the endpoint slices in scope by namespace and then
+// by the service they belong to
+func (cl *Cluster) getEndpointSlices(ctx context.Context, scope listScope) (map[string]map[string][]*discoveryv1.EndpointSlice, error) {
+	items, err := listItems[discoveryv1.EndpointSlice](ctx, cl, scope, func(ctx context.Context, ns string, opts metav1.ListOptions) (runtime.Object, error) {
+		return cl.ClientSet.DiscoveryV1().EndpointSlices(ns).List(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byService := make(map[string]map[string][]*discoveryv1.EndpointSlice, len(items))
+	for ns, list := range items {
+		m := make(map[string][]*discoveryv1.EndpointSlice)
+		for _, slice := range list {
+			if svc := slice.Labels[discoveryv1.LabelServiceName]; svc != "" {
+				m[svc] = append(m[svc], slice)
+			}
+		}
+		byService[ns] = m
+	}
+	return byService, nil
+}
+
+// serviceEndpoints sums up the slices of one service. ports are the numbers
+// named target ports resolved to, by service port name
+func serviceEndpoints(slices []*discoveryv1.EndpointSlice) (*ServiceEndpoints, map[string]int) {
+	eps := &ServiceEndpoints{Addresses: make([]*Endpoint, 0)}
+	ports := make(map[string]int)
+	// a dual stack service has a slice per ip family with the same pods
+	seen := make(map[string]bool)
+	for _, slice := range slices {
+		for _, p := range slice.Ports {
+			if p.Port != nil && p.Name != nil {
+				ports[*p.Name] = int(*p.Port)
+			}
+		}
+		for _, ep := range slice.Endpoints {
+			if len(ep.Addresses) == 0 {
+				continue
+			}
+			e := &Endpoint{
+				IP: ep.Addresses[0],
+				// unset ready and serving mean ready, see the EndpointConditions docs
+				Ready:       ep.Conditions.Ready == nil || *ep.Conditions.Ready,
+				Serving:     ep.Conditions.Serving == nil || *ep.Conditions.Serving,
+				Terminating: ep.Conditions.Terminating != nil && *ep.Conditions.Terminating,
+			}
+			if ep.NodeName != nil {
+				e.Node = *ep.NodeName
+			}
+			key := e.IP
+			if ref := ep.TargetRef; ref != nil && ref.Kind == "Pod" {
+				e.Pod = ref.Name
+				key = "pod/" + ref.Name
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			if e.Ready {
+				eps.Ready++
+			} else {
+				eps.NotReady++
+			}
+			eps.Addresses = append(eps.Addresses, e)
+		}
+	}
+	return eps, ports
+}
+
+// withServicePods is ov with every service linked to the pods its selector
+// picks, and the named target ports the endpoint slices left open resolved
+// against their containers. like withAllocation it runs for each snapshot,
+// on copies of the services
+func (ov *Overview) withServicePods() *Overview {
+	if ov.Services == nil {
+		return ov
+	}
+
+	byNS := make(map[string][]*PodsInfo)
+	if ov.Pods != nil {
+		for _, p := range ov.Pods.PodsList {
+			if p.Phase == string(v1.PodSucceeded) || p.Phase == string(v1.PodFailed) {
+				continue
+			}
+			byNS[p.NameSpace] = append(byNS[p.NameSpace], p)
+		}
+	}
+
+	next := *ov
+	services := *ov.Services
+	services.ServiceList = make([]*ServiceInfo, len(ov.Services.ServiceList))
+	for i, s := range ov.Services.ServiceList {
+		svc := *s
+		svc.Pods = nil
+		// without a selector the endpoints are managed by hand, and without
+		// pods there is nothing to link
+		var picked []*PodsInfo
+		if ov.Pods != nil && len(s.Selector) > 0 {
+			sel := labels.SelectorFromSet(s.Selector)
+			svc.Pods = make([]string, 0)
+			for _, p := range byNS[s.Namespace] {
+				if sel.Matches(labels.Set(p.Labels)) {
+					picked = append(picked, p)
+					svc.Pods = append(svc.Pods, p.Name)
+				}
+			}
+		}
+		svc.Ports = resolvePorts(s.Ports, picked)
+		services.ServiceList[i] = &svc
+	}
+	next.Services = &services
+	return &next
+}
+
+// resolvePorts fills in the named target ports the endpoint slices left open
+// from the container ports of pods. every pod resolves the name on its own,
+// the first one with it is taken. it starts over from the slices each time,
+// so a port pods resolved before follows them when they change
+func resolvePorts(ports []*Port, pods []*PodsInfo) []*Port {
+	out := make([]*Port, len(ports))
+	for i, port := range ports {
+		out[i] = port
+		if port.TargetPortName == "" {
+			continue
+		}
+		n := port.slicePort
+		if n == 0 {
+			n = containerPort(pods, port.TargetPortName, port.Protocol)
+		}
+		if n != port.TargetPort {
+			resolved := *port
+			resolved.TargetPort = n
+			out[i] = &resolved
+		}
+	}
+	return out
+}
+
+func containerPort(pods []*PodsInfo, name, protocol string) int {
+	for _, p := range pods {
+		for _, c := range p.Containers {
+			for _, port := range c.Ports {
+				if port.Name == name && port.Protocol == protocol {
+					return port.Port
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package server
+
+import "testing"
+
+func TestServicePodsResolveAgain(t *testing.T) {
+	pods := func(port int) *Pods {
+		return &Pods{PodsList: []*PodsInfo{{
+			Name: "web-1", NameSpace: "web", Labels: map[string]string{"app": "web"},
+			Containers: []*Container{{Ports: []*Port{{Name: "http", Port: port, Protocol: "TCP"}}}},
+		}}}
+	}
+	ov := &Overview{
+		Pods: pods(8080),
+		Services: &Services{ServiceList: []*ServiceInfo{{
+			Name: "web", Namespace: "web", Selector: map[string]string{"app": "web"},
+			Ports: []*Port{{Port: 80, TargetPortName: "http", Protocol: "TCP"}},
+		}}},
+	}
+
+	ov = ov.withServicePods()
+	if got := ov.Services.ServiceList[0].Ports[0].TargetPort; got != 8080 {
+		t.Fatalf("target port %d, want 8080", got)
+	}
+
+	// the next snapshot starts from this one, with the pods moved to 9090
+	next := *ov
+	next.Pods = pods(9090)
+	if got := next.withServicePods().Services.ServiceList[0].Ports[0].TargetPort; got != 9090 {
+		t.Errorf("target port %d after the pods changed, want 9090", got)
+	}
+
+	// without pods it is unresolved again
+	next.Pods = nil
+	if got := next.withServicePods().Services.ServiceList[0].Ports[0].TargetPort; got != 0 {
+		t.Errorf("target port %d without pods, want 0", got)
+	}
+
+	// what the slices resolved wins over the pods
+	next.Pods = pods(9090)
+	next.Services.ServiceList[0].Ports[0].slicePort = 7070
+	if got := next.withServicePods().Services.ServiceList[0].Ports[0].TargetPort; got != 7070 {
+		t.Errorf("target port %d, want 7070 from the slices", got)
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+)
+
+// handlers for the cluster registry and the fleet view across all clusters
+
+func (s *Server) clusterInfo(cl *Cluster, current string) *ClusterInfo {
+	info := &ClusterInfo{
+		Name:        cl.Name,
+		Labels:      cl.Labels,
+		Current:     cl.Name == current,
+		Namespaces:  cl.Namespaces,
+		Server:      cl.RestConfig.Host,
+		LastRefresh: cl.LastRefresh(),
+		Breaker:     cl.Breaker(),
+	}
+	if cl.kubeconfig != nil {
+		info.Context = cl.kubeconfig.context
+	}
+	return info
+}
+
+func (s *Server) apiClusters(w http.ResponseWriter, r *http.Request) {
+	current := s.currentName()
+	res := &ClustersResponse{Current: current, Clusters: make([]*ClusterInfo, 0)}
+	for _, cl := range s.Clusters() {
+		res.Clusters = append(res.Clusters, s.clusterInfo(cl, current))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) apiRegisterCluster(w http.ResponseWriter, r *http.Request) {
+	var reg ClusterRegistration
+	if err := readJSON(r, &reg); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if reg.Context == "" {
+		writeError(w, http.StatusBadRequest, "context is required")
+		return
+	}
+
+	from := s.Cluster(reg.From)
+	if from == nil {
+		writeError(w, http.StatusNotFound, "no cluster %q to take the kubeconfig from", reg.From)
+		return
+	}
+	if from.kubeconfig == nil {
+		writeError(w, http.StatusBadRequest, "cluster %s is not connected through a kubeconfig", from.Name)
+		return
+	}
+
+	cl, err := s.useKubeconfig(r.Context(), from.kubeconfig.raw, from.kubeconfig.uploaded, &reg, false)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.clusterInfo(cl, s.currentName()))
+}
+
+func (s *Server) apiRemoveCluster(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := validClusterName(name); err != nil {
+		writeErr(w, err)
+		return
+	}
+	// a valid name is a plain record name, forget only deletes it when the
+	// cluster was saved
+	forgotten, err := s.forget(name)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if !s.RemoveCluster(name) && !forgotten {
+		writeError(w, http.StatusNotFound, "no cluster named %q", name)
+		return
+	}
+	writeJSON(w, http.StatusOK, &MessageResponse{Message: "removed"})
+}
+
+// fleetCluster sums up one cluster from its cached overview. the status goes
+// by the collectors of the snapshot, a refresh of some kinds or of one
+// namespace says nothing about the rest
+func fleetCluster(cl *Cluster) *FleetCluster {
+	fc := &FleetCluster{Name: cl.Name, Labels: cl.Labels, Status: "ok", LastRefresh: cl.LastRefresh(), Breaker: cl.Breaker()}
+
+	ov := cl.Overview()
+	if ov == nil {
+		// nothing loaded yet, only the refreshes can tell
+		fc.Status = "pending"
+		if last := fc.LastRefresh; last != nil && last.Error != "" {
+			fc.Status, fc.Error = "error", last.Error
+		}
+		return fc
+	}
+	if err := ov.Err(); err != nil {
+		fc.Status, fc.Error = "degraded", err.Error()
+		if !ov.Loaded() {
+			fc.Status = "error"
+		}
+	}
+
+	// a failed refresh keeps serving the last good overview, so the counts
+	// can still be there next to the error
+	if ov.Nodes != nil {
+		fc.Nodes = &NodeCounts{Total: ov.Nodes.TotalNodes, Running: ov.Nodes.RunningNodes}
+	}
+	if ov.Pods != nil {
+		fc.Pods = &PodCounts{}
+		fc.Namespaces = make(map[string]*PodCounts)
+		for ns, total := range ov.Pods.TotalPods {
+			running := ov.Pods.RunningPods[ns]
+			fc.Namespaces[ns] = &PodCounts{Total: total, Running: running}
+			fc.Pods.Total += total
+			fc.Pods.Running += running
+		}
+	}
+	return fc
+}
+
+func (s *Server) apiFleet(w http.ResponseWriter, r *http.Request) {
+	selector, err := parseLabels(r.URL.Query().Get("selector"))
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	res := &FleetResponse{Totals: &FleetTotals{}, Clusters: make([]*FleetCluster, 0)}
+	for _, cl := range s.Clusters() {
+		if !matchesLabels(cl.Labels, selector) {
+			continue
+		}
+
+		fc := fleetCluster(cl)
+		res.Clusters = append(res.Clusters, fc)
+
+		t := res.Totals
+		t.Clusters++
+		if fc.Status == "ok" {
+			t.Healthy++
+		}
+		if fc.Nodes != nil {
+			t.Nodes.Total += fc.Nodes.Total
+			t.Nodes.Running += fc.Nodes.Running
+		}
+		if fc.Pods != nil {
+			t.Pods.Total += fc.Pods.Total
+			t.Pods.Running += fc.Pods.Running
+		}
+	}
+
+	// unhealthy clusters first, they are what someone opens this page for
+	sort.SliceStable(res.Clusters, func(i, j int) bool {
+		return res.Clusters[i].Status != "ok" && res.Clusters[j].Status == "ok"
+	})
+
+	writeJSON(w, http.StatusOK, res)
+}
@@ -3,22 +3,17 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
-	"os"
+	"strconv"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 )
 
-var allowedOrigins = map[string]bool{
-	"http://localhost:3000": true,
-	os.Getenv("CLIENT_IP"):  true,
-	"http://localhost:80":   true,
-}
-
-func EnableCors(w http.ResponseWriter, r *http.Request, origin string) {
-	if allowedOrigins[origin] {
+func (s *Server) EnableCors(w http.ResponseWriter, r *http.Request, origin string) {
+	if s.originAllowed(origin) {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 
 	}
@@ -36,7 +31,7 @@ func EnableCors(w http.ResponseWriter, r *http.Request, origin string) {
 
 func (s *Server) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allpowed", http.StatusMethodNotAllowed)
@@ -59,13 +54,28 @@ func (s *Server) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	// configID := session.Values["id"].(string)
 	// restConfig := s.ConfigStore[configID]
 
-	overview, err := s.GetOverview()
+	cl := s.Cluster("")
+	if cl == nil {
+		http.Error(w, "no cluster connected", http.StatusServiceUnavailable)
+		return
+	}
+	// every open tab polls this, an overview loaded a moment ago is kept
+	maxAge, err := maxAgeParam(r, s.Config().RefreshMaxAge.D())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	target, err := refreshTarget(r, cl)
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	_, err = cl.RefreshIfOlder(r.Context(), target, maxAge)
 
 	if err != nil {
 		http.Error(w, "error getting whatever it is that u wanted "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	s.Overview = overview
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "yay",
 	})
@@ -75,7 +85,7 @@ func (s *Server) RefreshHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) OverviewHandler(w http.ResponseWriter, r *http.Request) {
 	// get
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -94,11 +104,18 @@ func (s *Server) OverviewHandler(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
-	overview := s.Overview
+	overview := s.legacyOverview(w)
+	if overview == nil {
+		return
+	}
+	var totalNodes, runningNodes int
+	if overview.Nodes != nil {
+		totalNodes, runningNodes = overview.Nodes.TotalNodes, overview.Nodes.RunningNodes
+	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"totalNodes":   overview.Nodes.TotalNodes,
-		"runningNodes": overview.Nodes.RunningNodes,
+		"totalNodes":   totalNodes,
+		"runningNodes": runningNodes,
 		"pods":         overview.Pods,
 
 		"namespaces": overview.NameSpace,
@@ -114,72 +131,29 @@ func (s *Server) OverviewHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 	// gets the ~/.kube/config
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// user can upload ~/.kube/config file or paste the contents
-
-	pasted := r.FormValue("pasted")
-	var configBytes []byte
-
-	if pasted == "" {
-		// if not pasted, get the formfile
-		file, _, err := r.FormFile("file")
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		defer file.Close()
-
-		configBytes, err = io.ReadAll(file)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	} else {
-		configBytes = []byte(pasted)
-	}
-
-	config, err := clientcmd.Load(configBytes)
+	configBytes, err := s.readKubeconfig(w, r)
 	if err != nil {
-		http.Error(w, "error parsing the config file "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), statusOf(err))
 		return
-
 	}
 
-	c, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	reg, err := uploadRegistration(r)
 	if err != nil {
-		http.Error(w, "Failed to build config: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), statusOf(err))
 		return
 	}
-
-	// test connection
-
-	cs, err := NewClientSet(c)
-	if err != nil {
-		http.Error(w, "error creating client"+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	_, err = cs.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{Limit: 1})
+	_, err = s.connectKubeconfig(r.Context(), configBytes, reg)
 	if err != nil {
-		http.Error(w, "error connecting to cluster "+err.Error(), http.StatusUnauthorized)
+		http.Error(w, err.Error(), statusOf(err))
 		return
 	}
-
-	s.ClientSet = cs
-	s.RestConfig = c
-	overview, err := s.GetOverview()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-
-	}
-	s.Overview = overview
 	// configID := uuid.New().String()
 
 	// // cartoon logic frfr
@@ -206,6 +180,97 @@ func (s *Server) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// readKubeconfig gets the kubeconfig out of the request, the user can upload
+// ~/.kube/config or paste the contents
+func (s *Server) readKubeconfig(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxSize := s.Config().Uploads.MaxSize
+	tooLarge := newHTTPError(http.StatusRequestEntityTooLarge, "kubeconfig is larger than the %d bytes allowed", maxSize)
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.uploadLimit())
+	err := r.ParseMultipartForm(maxSize)
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return nil, tooLarge
+	}
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return nil, newHTTPError(http.StatusBadRequest, "%s", err.Error())
+	}
+
+	pasted := r.FormValue("pasted")
+	if pasted != "" {
+		if int64(len(pasted)) > maxSize {
+			return nil, tooLarge
+		}
+		return []byte(pasted), nil
+	}
+
+	// if not pasted, get the formfile
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "%s", err.Error())
+	}
+	defer file.Close()
+	if header.Size > maxSize {
+		return nil, tooLarge
+	}
+
+	configBytes, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return configBytes, nil
+}
+
+// uploadRegistration reads the optional context, namespace, name, labels and
+// namespaces fields sent along with an uploaded kubeconfig
+func uploadRegistration(r *http.Request) (*ClusterRegistration, error) {
+	labels, err := parseLabels(r.FormValue("labels"))
+	if err != nil {
+		return nil, err
+	}
+	return &ClusterRegistration{
+		Name:       r.FormValue("name"),
+		Labels:     labels,
+		Context:    r.FormValue("context"),
+		Namespace:  r.FormValue("namespace"),
+		Namespaces: splitNames(r.FormValue("namespaces")),
+	}, nil
+}
+
+// connectKubeconfig parses the kubeconfig and registers the cluster of one of
+// its contexts as the current one
+func (s *Server) connectKubeconfig(ctx context.Context, configBytes []byte, reg *ClusterRegistration) (*Cluster, error) {
+	config, err := parseKubeconfig(configBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.useKubeconfig(ctx, config, true, reg, true)
+}
+
+func parseKubeconfig(configBytes []byte) (*clientcmdapi.Config, error) {
+	config, err := clientcmd.Load(configBytes)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "error parsing the config file %s", err.Error())
+	}
+	return config, nil
+}
+
+// legacyOverview is the current cluster's overview, the legacy routes only
+// know about one cluster. it answers 503 itself when there is none
+func (s *Server) legacyOverview(w http.ResponseWriter) *Overview {
+	cl := s.Cluster("")
+	if cl == nil {
+		http.Error(w, "no cluster connected", http.StatusServiceUnavailable)
+		return nil
+	}
+	ov := cl.Overview()
+	if ov == nil {
+		http.Error(w, "no overview loaded yet", http.StatusServiceUnavailable)
+	}
+	return ov
+}
+
 func (s *Server) PodsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// get
@@ -213,7 +278,7 @@ func (s *Server) PodsHandler(w http.ResponseWriter, r *http.Request) {
 	// logs
 	// kubectl get pods -o wide
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -232,10 +297,17 @@ func (s *Server) PodsHandler(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
-	ov := s.Overview
-	pods := ov.Pods
-	ns_list := ov.NameSpace.NameSpaceList
-	pods.NamespaceList = ns_list
+	ov := s.legacyOverview(w)
+	if ov == nil {
+		return
+	}
+	if ov.Pods == nil {
+		http.Error(w, "pods are not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	// the overview is shared with every other request, fill in a copy
+	pods := *ov.Pods
+	pods.NamespaceList = ov.namespaceList()
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"pods": pods,
@@ -246,7 +318,7 @@ func (s *Server) PodsHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) IngressHandler(w http.ResponseWriter, r *http.Request) {
 	// get
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -265,10 +337,16 @@ func (s *Server) IngressHandler(w http.ResponseWriter, r *http.Request) {
 	// 	return
 
 	// }
-	ov := s.Overview
-	ingress := ov.Ingress
-	ns_list := ov.NameSpace.NameSpaceList
-	ingress.NameSpaceList = ns_list
+	ov := s.legacyOverview(w)
+	if ov == nil {
+		return
+	}
+	if ov.Ingress == nil {
+		http.Error(w, "ingress are not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	ingress := *ov.Ingress
+	ingress.NameSpaceList = ov.namespaceList()
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"ingress": ingress,
@@ -278,7 +356,7 @@ func (s *Server) IngressHandler(w http.ResponseWriter, r *http.Request) {
 
 // func (s *Server) DelPodHandler(w http.ResponseWriter, r *http.Request) {
 // 	origin := r.Header.Get("Origin")
-// 	EnableCors(w, r, origin)
+// 	s.EnableCors(w, r, origin)
 
 // 	if r.Method != http.MethodPost {
 // 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -311,13 +389,18 @@ func (s *Server) IngressHandler(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) RestartPodHandler(w http.ResponseWriter, r *http.Request) {
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	if !s.featureEnabled("restartPods") {
+		http.Error(w, "restarting pods is disabled", http.StatusNotFound)
+		return
+	}
+
 	var res struct {
 		PodName   string `json:"podname"`
 		NameSpace string `json:"namespace"`
@@ -328,7 +411,12 @@ func (s *Server) RestartPodHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.DeletePod(res.NameSpace, res.PodName)
+	cl := s.Cluster("")
+	if cl == nil {
+		http.Error(w, "no cluster connected", http.StatusServiceUnavailable)
+		return
+	}
+	err = cl.DeletePod(r.Context(), res.NameSpace, res.PodName)
 	if err != nil {
 		http.Error(w, "couldnt retstart"+err.Error(), http.StatusInternalServerError)
 		return
@@ -344,7 +432,7 @@ func (s *Server) RestartPodHandler(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) ConfigMapHandler(w http.ResponseWriter, r *http.Request) {
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -363,10 +451,16 @@ func (s *Server) ConfigMapHandler(w http.ResponseWriter, r *http.Request) {
 	// 	return
 
 	// }
-	ov := s.Overview
-	m := ov.ConfigMaps
-	ns_list := ov.NameSpace.NameSpaceList
-	m.NameSpaceList = ns_list
+	ov := s.legacyOverview(w)
+	if ov == nil {
+		return
+	}
+	if ov.ConfigMaps == nil {
+		http.Error(w, "configmaps are not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	m := *ov.ConfigMaps
+	m.NameSpaceList = ov.namespaceList()
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"configmap": m,
@@ -377,7 +471,7 @@ func (s *Server) ConfigMapHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) NodesHandler(w http.ResponseWriter, r *http.Request) {
 
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -397,7 +491,11 @@ func (s *Server) NodesHandler(w http.ResponseWriter, r *http.Request) {
 
 	// }
 
-	nodes := s.Overview.Nodes
+	ov := s.legacyOverview(w)
+	if ov == nil {
+		return
+	}
+	nodes := ov.Nodes
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"nodes": nodes,
@@ -409,7 +507,7 @@ func (s *Server) SVCHandler(w http.ResponseWriter, r *http.Request) {
 	// all about svc's
 	// get
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -428,10 +526,16 @@ func (s *Server) SVCHandler(w http.ResponseWriter, r *http.Request) {
 	// 	return
 
 	// }
-	ov := s.Overview
-	svc := ov.Services
-	ns_list := ov.NameSpace.NameSpaceList
-	svc.NameSpaceList = ns_list
+	ov := s.legacyOverview(w)
+	if ov == nil {
+		return
+	}
+	if ov.Services == nil {
+		http.Error(w, "services are not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	svc := *ov.Services
+	svc.NameSpaceList = ov.namespaceList()
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"services": svc,
@@ -443,7 +547,7 @@ func (s *Server) SecretsHandler(w http.ResponseWriter, r *http.Request) {
 	// all info about secrets
 	// get
 	origin := r.Header.Get("Origin")
-	EnableCors(w, r, origin)
+	s.EnableCors(w, r, origin)
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -463,13 +567,65 @@ func (s *Server) SecretsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// }
 
-	ov := s.Overview
-	secrets := ov.Secrets
-	ns_list := ov.NameSpace.NameSpaceList
-	secrets.NameSpaceList = ns_list
+	ov := s.legacyOverview(w)
+	if ov == nil {
+		return
+	}
+	if ov.Secrets == nil {
+		http.Error(w, "secrets are not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	secrets := *ov.Secrets
+	secrets.NameSpaceList = ov.namespaceList()
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"secrets": secrets,
 	})
 
 }
+
+func (s *Server) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	// find whatever an ip, hostname or name belongs to
+	origin := r.Header.Get("Origin")
+	s.EnableCors(w, r, origin)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.featureEnabled("search") {
+		http.Error(w, "search is disabled", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "missing search query q", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ov := s.legacyOverview(w)
+	if ov == nil {
+		return
+	}
+
+	results, total := ov.Search(q, limit)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   q,
+		"total":   total,
+		"results": results,
+	})
+
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"server/internal/version"
+)
+
+// probes for running the dashboard itself in kubernetes. they live outside
+// /api/v1 at the paths kubelet and everyone else expect
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+type CheckResult struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+type ReadinessResponse struct {
+	Status      string         `json:"status"` // ok or failing
+	Checks      []*CheckResult `json:"checks"`
+	LastRefresh *RefreshStatus `json:"lastRefresh,omitempty"`
+}
+
+// readinessCheck is one subsystem the server needs before it can answer
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+func (s *Server) readinessChecks() []readinessCheck {
+	// collectors list straight from the api server, there are no informer
+	// caches to wait on so connection and the snapshot are all there is
+	return []readinessCheck{
+		{name: "cluster", check: func() error {
+			if s.Cluster("") == nil {
+				return errors.New("no cluster connected")
+			}
+			return nil
+		}},
+		{name: "refresh", check: func() error {
+			cl := s.Cluster("")
+			if cl == nil || cl.Overview() == nil {
+				if last := s.lastRefresh(); last != nil && last.Error != "" {
+					return errors.New("overview not loaded: " + last.Error)
+				}
+				return errors.New("overview not loaded yet")
+			}
+			// a partial overview is still served, the collectors say what is missing
+			if ov := cl.Overview(); !ov.Loaded() {
+				return errors.New("no part of the overview loaded: " + ov.Err().Error())
+			}
+			return nil
+		}},
+	}
+}
+
+// lastRefresh is the current cluster's, readiness is about the cluster the
+// legacy ui shows. /fleet has the status of the others
+func (s *Server) lastRefresh() *RefreshStatus {
+	cl := s.Cluster("")
+	if cl == nil {
+		return nil
+	}
+	return cl.LastRefresh()
+}
+
+// HealthzHandler only says the process is up and serving
+func (s *Server) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &HealthResponse{Status: "ok"})
+}
+
+// ReadyzHandler runs every readiness check and answers 503 naming the ones
+// that fail
+func (s *Server) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	res := &ReadinessResponse{Status: "ok", LastRefresh: s.lastRefresh()}
+	status := http.StatusOK
+
+	for _, c := range s.readinessChecks() {
+		result := &CheckResult{Name: c.name, OK: true}
+		if err := c.check(); err != nil {
+			result.OK = false
+			result.Message = err.Error()
+			res.Status = "failing"
+			status = http.StatusServiceUnavailable
+		}
+		res.Checks = append(res.Checks, result)
+	}
+
+	writeJSON(w, status, res)
+}
+
+func (s *Server) VersionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.Get())
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+// Identity is who is making a request. with mtls that is the user mapped from
+// the client certificate, everyone else is anonymous
+type Identity struct {
+	User    string `json:"user"`
+	Method  string `json:"method"` // anonymous or client-certificate
+	Subject string `json:"subject,omitempty"`
+}
+
+type ctxKey int
+
+const identityKey ctxKey = iota
+
+var anonymous = &Identity{User: "anonymous", Method: "anonymous"}
+
+func IdentityFrom(ctx context.Context) *Identity {
+	if id, ok := ctx.Value(identityKey).(*Identity); ok {
+		return id
+	}
+	return anonymous
+}
+
+// identify maps a verified client certificate to a dashboard user. when
+// tls.clientUsers is set only the subjects listed there get in
+func (s *Server) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		subject := cert.Subject.String()
+		users := s.Config().TLS.ClientUsers
+
+		user := cert.Subject.CommonName
+		if len(users) > 0 {
+			u, ok := users[subject]
+			if !ok {
+				u, ok = users[cert.Subject.CommonName]
+			}
+			if !ok {
+				writeError(w, http.StatusForbidden, "client certificate %q is not mapped to a user", subject)
+				return
+			}
+			user = u
+		}
+
+		id := &Identity{User: user, Method: "client-certificate", Subject: subject}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, id)))
+	})
+}
+
+func (s *Server) apiWhoAmI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, IdentityFrom(r.Context()))
+}
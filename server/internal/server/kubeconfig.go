@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubeconfig is the file the current connection was built from, kept so
+// another context can be picked without uploading it again
+type kubeconfig struct {
+	raw       *clientcmdapi.Config
+	context   string
+	namespace string
+	// uploaded ones are checked against the upload policy, the startup one
+	// is trusted
+	uploaded bool
+	warnings []*ValidationIssue
+}
+
+// resolveContext picks the context to use out of raw, name may be empty for
+// the current-context
+func resolveContext(raw *clientcmdapi.Config, name string) (string, error) {
+	if name == "" {
+		name = raw.CurrentContext
+	}
+	if name == "" && len(raw.Contexts) == 1 {
+		for n := range raw.Contexts {
+			name = n
+		}
+	}
+	if name == "" {
+		return "", newHTTPError(http.StatusBadRequest, "kubeconfig has no current-context, pick one of %s", strings.Join(contextNames(raw), ", "))
+	}
+	if _, ok := raw.Contexts[name]; !ok {
+		return "", newHTTPError(http.StatusBadRequest, "context %q is not in the kubeconfig, it has %s", name, strings.Join(contextNames(raw), ", "))
+	}
+	return name, nil
+}
+
+// useKubeconfig registers the cluster of one of raw's contexts. uploaded
+// clusters are saved so they come back after a restart
+func (s *Server) useKubeconfig(ctx context.Context, raw *clientcmdapi.Config, uploaded bool, reg *ClusterRegistration, makeCurrent bool) (*Cluster, error) {
+	cl, err := s.clusterFromKubeconfig(raw, uploaded, reg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.connect(ctx, cl, makeCurrent)
+	if s.Cluster(cl.Name) == cl {
+		s.save(cl)
+	}
+	return cl, err
+}
+
+// clusterFromKubeconfig builds the cluster for one of raw's contexts without
+// connecting. the name defaults to the context's and the namespace to the one
+// set on the context
+func (s *Server) clusterFromKubeconfig(raw *clientcmdapi.Config, uploaded bool, reg *ClusterRegistration) (*Cluster, error) {
+	contextName, err := resolveContext(raw, reg.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []*ValidationIssue
+	if uploaded {
+		report := validateKubeconfig(raw, s.Config().Uploads)
+		if len(report.errorsFor(contextName)) > 0 {
+			return nil, &invalidKubeconfigError{context: contextName, report: report}
+		}
+		warnings = report.warningsFor(contextName)
+	}
+
+	namespace := reg.Namespace
+	if namespace == "" {
+		namespace = raw.Contexts[contextName].Namespace
+	}
+	name := reg.Name
+	if name == "" {
+		name = defaultClusterName(contextName)
+	}
+	if err := validClusterName(name); err != nil {
+		return nil, err
+	}
+	for _, ns := range reg.Namespaces {
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return nil, newHTTPError(http.StatusBadRequest, "namespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+	}
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: contextName}
+	c, err := clientcmd.NewDefaultClientConfig(*raw, overrides).ClientConfig()
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "Failed to build config: %s", err.Error())
+	}
+
+	kc := &kubeconfig{raw: raw, context: contextName, namespace: namespace, uploaded: uploaded, warnings: warnings}
+	cl, err := newCluster(name, reg.Labels, c, kc)
+	if err != nil {
+		return nil, newHTTPError(http.StatusInternalServerError, "error creating client %s", err.Error())
+	}
+	cl.Namespaces = reg.Namespaces
+	return cl, nil
+}
+
+func contextNames(raw *clientcmdapi.Config) []string {
+	names := make([]string, 0, len(raw.Contexts))
+	for n := range raw.Contexts {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// kubeconfigResponse describes the kubeconfig behind cl, which must have one
+func kubeconfigResponse(cl *Cluster, message string) *KubeconfigResponse {
+	kc := cl.kubeconfig
+	res := &KubeconfigResponse{
+		Message:        message,
+		Cluster:        cl.Name,
+		Warnings:       kc.warnings,
+		CurrentContext: kc.context,
+		Namespace:      kc.namespace,
+		Contexts:       make([]*KubeconfigContext, 0, len(kc.raw.Contexts)),
+		Clusters:       make([]string, 0, len(kc.raw.Clusters)),
+		Users:          make([]string, 0, len(kc.raw.AuthInfos)),
+	}
+
+	for _, name := range contextNames(kc.raw) {
+		c := kc.raw.Contexts[name]
+		info := &KubeconfigContext{Name: name, Cluster: c.Cluster, User: c.AuthInfo, Namespace: c.Namespace}
+		if cl, ok := kc.raw.Clusters[c.Cluster]; ok {
+			info.Server = cl.Server
+		}
+		res.Contexts = append(res.Contexts, info)
+	}
+	for name := range kc.raw.Clusters {
+		res.Clusters = append(res.Clusters, name)
+	}
+	for name := range kc.raw.AuthInfos {
+		res.Users = append(res.Users, name)
+	}
+	sort.Strings(res.Clusters)
+	sort.Strings(res.Users)
+
+	return res
+}
+
+func (s *Server) apiContext(w http.ResponseWriter, r *http.Request) {
+	cl, ok := s.selectCluster(w, r)
+	if !ok {
+		return
+	}
+	if cl.kubeconfig == nil {
+		writeError(w, http.StatusNotFound, "cluster %s is not connected through a kubeconfig", cl.Name)
+		return
+	}
+	writeJSON(w, http.StatusOK, kubeconfigResponse(cl, ""))
+}
+
+// apiSwitchContext points a registered cluster at another context of the
+// same kubeconfig, keeping its name and labels
+func (s *Server) apiSwitchContext(w http.ResponseWriter, r *http.Request) {
+	var body ContextSwitch
+	if err := readJSON(r, &body); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if body.Context == "" {
+		writeError(w, http.StatusBadRequest, "context is required")
+		return
+	}
+
+	cl, ok := s.selectCluster(w, r)
+	if !ok {
+		return
+	}
+	if cl.kubeconfig == nil {
+		writeError(w, http.StatusNotFound, "cluster %s is not connected through a kubeconfig", cl.Name)
+		return
+	}
+
+	reg := &ClusterRegistration{Name: cl.Name, Labels: cl.Labels, Context: body.Context, Namespace: body.Namespace, Namespaces: cl.Namespaces}
+	next, err := s.useKubeconfig(r.Context(), cl.kubeconfig.raw, cl.kubeconfig.uploaded, reg, false)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, kubeconfigResponse(next, "switched"))
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"server/internal/config"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/pager"
+)
+
+// lister lists one page of a kind in ns, "" for all namespaces
+type lister func(ctx context.Context, ns string, opts metav1.ListOptions) (runtime.Object, error)
+
+// listScope is where one collector lists from
+type listScope struct {
+	namespaces []string
+	// one list across all namespaces replaces the per-namespace ones
+	clusterWide bool
+}
+
+// collection is the config's collection settings as of this refresh
+func (cl *Cluster) collection() config.Collection {
+	if cl.settings == nil {
+		return config.Default().Collection
+	}
+	return cl.settings().Collection
+}
+
+// callContext bounds a single call to the api server by the configured
+// call timeout, on top of whatever deadline ctx already has
+func (cl *Cluster) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t := cl.collection().CallTimeout; t > 0 {
+		return context.WithTimeout(ctx, t.D())
+	}
+	return context.WithCancel(ctx)
+}
+
+// listScope picks the list strategy for a kind, cluster-wide needs the
+// credentials to allow it everywhere
+func (cl *Cluster) listScope(ka *kindAccess, scope string) listScope {
+	ls := listScope{namespaces: ka.allowed}
+	switch cl.collection().Strategy {
+	case "cluster":
+		ls.clusterWide = ka.all
+	case "auto":
+		// a few declared namespaces are cheaper listed one by one than
+		// filtered out of everything
+		ls.clusterWide = ka.all && scope == "cluster"
+	}
+	return ls
+}
+
+// listPaged calls each for every object in ns, a page at a time. every page
+// is its own call with a deadline and retries, so one slow page fails on its
+// own instead of eating the whole refresh
+func (cl *Cluster) listPaged(ctx context.Context, ns string, list lister, each func(obj runtime.Object) error) error {
+	p := pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		var page runtime.Object
+		err := cl.call(ctx, func(ctx context.Context) (err error) {
+			page, err = list(ctx, ns, opts)
+			return err
+		})
+		return page, err
+	})
+	p.PageSize = int64(cl.collection().PageSize)
+	return p.EachListItem(ctx, metav1.ListOptions{}, each)
+}
+
+// listItems lists a kind from every namespace in scope, grouped by
+// namespace. cluster-wide it is a single paged list, otherwise a bounded pool
+// of workers lists the namespaces and the first error stops the rest
+func listItems[T any](ctx context.Context, cl *Cluster, scope listScope, list lister) (map[string][]*T, error) {
+	byNS := make(map[string][]*T, len(scope.namespaces))
+
+	if scope.clusterWide {
+		wanted := make(map[string]bool, len(scope.namespaces))
+		for _, ns := range scope.namespaces {
+			wanted[ns] = true
+		}
+		err := cl.listPaged(ctx, "", list, func(obj runtime.Object) error {
+			ns := obj.(metav1.Object).GetNamespace()
+			if wanted[ns] {
+				byNS[ns] = append(byNS[ns], any(obj).(*T))
+			}
+			return nil
+		})
+		return byNS, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for range min(cl.collection().Workers, len(scope.namespaces)) {
+		wg.Go(func() {
+			for ns := range jobs {
+				var items []*T
+				err := cl.listPaged(ctx, ns, list, func(obj runtime.Object) error {
+					items = append(items, any(obj).(*T))
+					return nil
+				})
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("namespace %s: %w", ns, err)
+					cancel()
+				}
+				byNS[ns] = items
+				mu.Unlock()
+			}
+		})
+	}
+
+feed:
+	for _, ns := range scope.namespaces {
+		select {
+		case jobs <- ns:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return byNS, ctx.Err()
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"server/internal/config"
+
+	authv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeCluster is a cluster on a fake clientset that allows everything, with
+// cfg for its collection settings
+func fakeCluster(cfg *config.Config, objs ...runtime.Object) (*Cluster, *fake.Clientset) {
+	cs := fake.NewClientset(objs...)
+	cs.PrependReactor("create", "selfsubjectaccessreviews", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &authv1.SelfSubjectAccessReview{Status: authv1.SubjectAccessReviewStatus{Allowed: true}}, nil
+	})
+	cl := &Cluster{Name: "test", ClientSet: cs, breaker: newBreaker(), settings: func() *config.Config { return cfg }}
+	return cl, cs
+}
+
+// servePods answers pod lists from pods, a page of opts.Limit at a time with
+// the offset as continue token like the api server. the object tracker of
+// the fake clientset copies every object on every list and would be most of
+// what a benchmark measures
+func servePods(cs *fake.Clientset, pods []v1.Pod) {
+	byNS := map[string][]v1.Pod{"": pods}
+	for _, p := range pods {
+		byNS[p.Namespace] = append(byNS[p.Namespace], p)
+	}
+
+	cs.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		list := action.(k8stesting.ListActionImpl)
+		items, opts := byNS[list.GetNamespace()], list.GetListOptions()
+
+		start := 0
+		if opts.Continue != "" {
+			start, _ = strconv.Atoi(opts.Continue)
+		}
+		end := len(items)
+		res := &v1.PodList{}
+		if opts.Limit > 0 && start+int(opts.Limit) < end {
+			end = start + int(opts.Limit)
+			res.Continue = strconv.Itoa(end)
+		}
+		res.Items = items[start:end]
+		return true, res, nil
+	})
+}
+
+// podsByNamespace is pods spread evenly over namespaces, grouped by
+// namespace like a cluster-wide list returns them
+func podsByNamespace(namespaces, perNamespace int) ([]string, []v1.Pod) {
+	names := make([]string, namespaces)
+	pods := make([]v1.Pod, 0, namespaces*perNamespace)
+	for n := range namespaces {
+		names[n] = fmt.Sprintf("ns-%03d", n)
+		for i := range perNamespace {
+			pods = append(pods, v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%05d", i), Namespace: names[n]}})
+		}
+	}
+	return names, pods
+}
+
+func listPods(ctx context.Context, cl *Cluster, scope listScope) (map[string][]*v1.Pod, error) {
+	return listItems[v1.Pod](ctx, cl, scope, func(ctx context.Context, ns string, opts metav1.ListOptions) (runtime.Object, error) {
+		return cl.ClientSet.CoreV1().Pods(ns).List(ctx, opts)
+	})
+}
+
+func TestListItems(t *testing.T) {
+	names, pods := podsByNamespace(20, 130)
+	for _, clusterWide := range []bool{true, false} {
+		t.Run(fmt.Sprintf("clusterWide=%v", clusterWide), func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Collection.PageSize = 100
+			cl, cs := fakeCluster(cfg)
+			servePods(cs, pods)
+
+			// the last namespace is left out and must not show up
+			scope := listScope{namespaces: names[:len(names)-1], clusterWide: clusterWide}
+			byNS, err := listPods(context.Background(), cl, scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(byNS) != len(scope.namespaces) {
+				t.Errorf("got %d namespaces, want %d", len(byNS), len(scope.namespaces))
+			}
+			for _, ns := range scope.namespaces {
+				if len(byNS[ns]) != 130 {
+					t.Errorf("namespace %s has %d pods, want 130", ns, len(byNS[ns]))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListItems(b *testing.B) {
+	sizes := []struct{ namespaces, perNamespace int }{
+		{10, 2000},
+		{200, 100},
+		{500, 60},
+	}
+	for _, size := range sizes {
+		names, pods := podsByNamespace(size.namespaces, size.perNamespace)
+		for _, clusterWide := range []bool{true, false} {
+			strategy := "namespaces"
+			if clusterWide {
+				strategy = "cluster"
+			}
+			b.Run(fmt.Sprintf("%s/%dx%d", strategy, size.namespaces, size.perNamespace), func(b *testing.B) {
+				cl, cs := fakeCluster(config.Default())
+				servePods(cs, pods)
+				scope := listScope{namespaces: names, clusterWide: clusterWide}
+
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := listPods(context.Background(), cl, scope); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
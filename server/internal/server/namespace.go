@@ -0,0 +1,175 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// refreshing one namespace lists just that namespace and swaps its items
+// into the parts of the snapshot, the pods page uses it after a restart
+
+// namespacedKinds are the kinds a refresh can be narrowed to a namespace for
+var namespacedKinds = []string{"pods", "services", "ingress", "secrets", "configmaps"}
+
+// getNamespaceOverview runs the namespaced collectors of kinds, all of them
+// when kinds is empty, for the namespace ns alone. the parts that loaded
+// only hold ns and are meant for mergeNamespace. a kind prev has no part for
+// can not be merged into and fails, it needs a refresh of its own first
+func (cl *Cluster) getNamespaceOverview(ctx context.Context, kinds []string, ns string, prev *Overview) (*Overview, error) {
+	if prev == nil || !slices.Contains(prev.namespaceList(), ns) {
+		return nil, fmt.Errorf("namespace %s is not in the overview", ns)
+	}
+	access := cl.access(ctx, prev.namespaceList())
+
+	ov := &Overview{}
+	start := time.Now()
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		loaded   bool
+		failed   []error
+		statuses = make(map[string]*CollectorStatus)
+	)
+	for _, c := range cl.collectors(ctx, ov) {
+		if !c.namespaced || (len(kinds) > 0 && !slices.Contains(kinds, c.name)) {
+			continue
+		}
+		if !prev.has(c.name) {
+			err := fmt.Errorf("%s are not loaded, refresh them across namespaces first", c.name)
+			statuses[c.name] = collectorStatus(c.name, start, err)
+			failed = append(failed, err)
+			continue
+		}
+		if ka := access[c.name]; !ka.all && !slices.Contains(ka.allowed, ns) {
+			statuses[c.name] = &CollectorStatus{Name: c.name, Status: "skipped", Message: "no access to list " + c.name, At: start, SkippedNamespaces: []string{ns}}
+			continue
+		}
+
+		wg.Go(func() {
+			err := c.safeRun(listScope{namespaces: []string{ns}})
+			mu.Lock()
+			defer mu.Unlock()
+			statuses[c.name] = collectorStatus(c.name, start, err)
+			if err != nil {
+				failed = append(failed, fmt.Errorf("%s: %w", c.name, err))
+			} else {
+				loaded = true
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, kind := range namespacedKinds {
+		if c := statuses[kind]; c != nil {
+			ov.Collectors = append(ov.Collectors, c)
+		}
+	}
+
+	switch {
+	case loaded:
+		return ov, nil
+	case len(failed) > 0:
+		return nil, errors.Join(failed...)
+	}
+	return nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, ns, errors.New("no access to list anything asked for in it"))
+}
+
+// has is whether the part for kind loaded
+func (ov *Overview) has(kind string) bool {
+	switch kind {
+	case "namespaces":
+		return ov.NameSpace != nil
+	case "nodes":
+		return ov.Nodes != nil
+	case "pods":
+		return ov.Pods != nil
+	case "services":
+		return ov.Services != nil
+	case "ingress":
+		return ov.Ingress != nil
+	case "secrets":
+		return ov.Secrets != nil
+	case "configmaps":
+		return ov.ConfigMaps != nil
+	}
+	return false
+}
+
+// mergeNamespace is a copy of ov with the namespace ns of the parts that
+// loaded in part swapped in. the statuses stay, they are about whole kinds
+func (ov *Overview) mergeNamespace(part *Overview, ns string) *Overview {
+	next := *ov
+	order := ov.namespaceList()
+	for _, c := range part.Collectors {
+		if c.Status != "ok" || !ov.has(c.Name) {
+			continue
+		}
+		switch c.Name {
+		case "pods":
+			p := *ov.Pods
+			p.TotalPods = withEntry(p.TotalPods, ns, part.Pods.TotalPods[ns])
+			p.RunningPods = withEntry(p.RunningPods, ns, part.Pods.RunningPods[ns])
+			p.Resources = withEntry(p.Resources, ns, part.Pods.Resources[ns])
+			p.PodsList = replaceNamespace(p.PodsList, part.Pods.PodsList, ns, order, func(i *PodsInfo) string { return i.NameSpace })
+			next.Pods = &p
+		case "services":
+			svc := *ov.Services
+			svc.Totalservices = withEntry(svc.Totalservices, ns, part.Services.Totalservices[ns])
+			svc.ServiceList = replaceNamespace(svc.ServiceList, part.Services.ServiceList, ns, order, func(i *ServiceInfo) string { return i.Namespace })
+			// the other namespaces still miss their endpoints after an earlier failure
+			svc.EndpointsError = cmp.Or(part.Services.EndpointsError, svc.EndpointsError)
+			next.Services = &svc
+		case "ingress":
+			ing := *ov.Ingress
+			ing.TotalIngress = withEntry(ing.TotalIngress, ns, part.Ingress.TotalIngress[ns])
+			ing.IngressList = replaceNamespace(ing.IngressList, part.Ingress.IngressList, ns, order, func(i *IngressInfo) string { return i.Namespace })
+			next.Ingress = &ing
+		case "secrets":
+			sec := *ov.Secrets
+			sec.TotalSecrets = withEntry(sec.TotalSecrets, ns, part.Secrets.TotalSecrets[ns])
+			sec.Secrets = replaceNamespace(sec.Secrets, part.Secrets.Secrets, ns, order, func(i *SecretsInfo) string { return i.NameSpace })
+			next.Secrets = &sec
+		case "configmaps":
+			m := *ov.ConfigMaps
+			m.Total = withEntry(m.Total, ns, part.ConfigMaps.Total[ns])
+			m.Confs = replaceNamespace(m.Confs, part.ConfigMaps.Confs, ns, order, func(i *ConfigMapInfo) string { return i.NameSpace })
+			next.ConfigMaps = &m
+		}
+	}
+	return &next
+}
+
+// withEntry is a copy of m with ns set to v
+func withEntry[V any](m map[string]V, ns string, v V) map[string]V {
+	next := maps.Clone(m)
+	if next == nil {
+		next = make(map[string]V)
+	}
+	next[ns] = v
+	return next
+}
+
+// replaceNamespace is items with the ones in ns swapped for fresh, in the
+// namespace order the collectors list them in
+func replaceNamespace[T any](items, fresh []*T, ns string, order []string, namespace func(*T) string) []*T {
+	byNamespace := make(map[string][]*T)
+	for _, it := range items {
+		byNamespace[namespace(it)] = append(byNamespace[namespace(it)], it)
+	}
+	byNamespace[ns] = fresh
+
+	next := make([]*T, 0, len(items)+len(fresh))
+	for _, n := range order {
+		next = append(next, byNamespace[n]...)
+	}
+	return next
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// NodeCondition is one of the conditions the kubelet reports, Ready and the
+// pressure ones. status is True, False or Unknown
+type NodeCondition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lasttransition,omitzero"`
+}
+
+// Taint keeps pods off a node unless they tolerate it
+type Taint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+// the well known labels, the beta ones are what older clusters still set
+const (
+	labelZone             = "topology.kubernetes.io/zone"
+	labelZoneBeta         = "failure-domain.beta.kubernetes.io/zone"
+	labelRegion           = "topology.kubernetes.io/region"
+	labelRegionBeta       = "failure-domain.beta.kubernetes.io/region"
+	labelInstanceType     = "node.kubernetes.io/instance-type"
+	labelInstanceTypeBeta = "beta.kubernetes.io/instance-type"
+	labelRolePrefix       = "node-role.kubernetes.io/"
+	labelRole             = "kubernetes.io/role"
+)
+
+// nodeRoles are the roles kubectl get nodes shows, from the
+// node-role.kubernetes.io/<role> labels and the older kubernetes.io/role
+func nodeRoles(labels map[string]string) []string {
+	var roles []string
+	for k, v := range labels {
+		switch {
+		case strings.HasPrefix(k, labelRolePrefix):
+			if role := strings.TrimPrefix(k, labelRolePrefix); role != "" {
+				roles = append(roles, role)
+			}
+		case k == labelRole && v != "":
+			roles = append(roles, v)
+		}
+	}
+	slices.Sort(roles)
+	return slices.Compact(roles)
+}
+
+func nodeConditions(node *v1.Node) []*NodeCondition {
+	conditions := make([]*NodeCondition, 0, len(node.Status.Conditions))
+	for _, c := range node.Status.Conditions {
+		conditions = append(conditions, &NodeCondition{
+			Type:               string(c.Type),
+			Status:             string(c.Status),
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: c.LastTransitionTime.Time,
+		})
+	}
+	return conditions
+}
+
+func nodeTaints(node *v1.Node) []*Taint {
+	taints := make([]*Taint, 0, len(node.Spec.Taints))
+	for _, t := range node.Spec.Taints {
+		taints = append(taints, &Taint{Key: t.Key, Value: t.Value, Effect: string(t.Effect)})
+	}
+	return taints
+}
+
+// nodePressure are the conditions other than Ready that are not False, a
+// node under memory or disk pressure starts evicting pods
+func nodePressure(conditions []*NodeCondition) []string {
+	var pressure []string
+	for _, c := range conditions {
+		if c.Type != string(v1.NodeReady) && c.Status != string(v1.ConditionFalse) {
+			pressure = append(pressure, c.Type)
+		}
+	}
+	return pressure
+}
+
+// label is the first of keys set in labels
+func label(labels map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v := labels[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Node is the node called name, nil when there is none
+func (n *Nodes) Node(name string) *Nodesinfo {
+	for _, node := range n.Nodes {
+		if node.Name == name {
+			return node
+		}
+	}
+	return nil
+}
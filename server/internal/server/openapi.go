@@ -0,0 +1,258 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the openapi 3 document is generated from APIRoutes and the go types in
+// their Request/Response fields, so it cant drift from what we serve
+
+const apiVersion = "1.0.0"
+
+type OpenAPIDoc struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       *OpenAPIInfo                     `json:"info"`
+	Servers    []*OpenAPIServer                 `json:"servers"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components *Components                      `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var pathParamRe = regexp.MustCompile(`\{([^}]+)\}`)
+
+// OpenAPI builds the document for the /api/v1 routes under prefix
+func (s *Server) OpenAPI(prefix string) *OpenAPIDoc {
+	g := &schemaGen{schemas: make(map[string]*Schema)}
+
+	doc := &OpenAPIDoc{
+		OpenAPI: "3.0.3",
+		Info:    &OpenAPIInfo{Title: "kube monitering", Version: apiVersion},
+		Servers: []*OpenAPIServer{{URL: prefix + apiPrefix}},
+		Paths:   make(map[string]map[string]*Operation),
+	}
+
+	errSchema := g.schemaFor(reflect.TypeOf(ErrorResponse{}))
+
+	for _, rt := range s.APIRoutes() {
+		op := &Operation{
+			OperationID: operationID(rt),
+			Summary:     rt.Summary,
+			Responses:   make(map[string]*Response),
+		}
+
+		for _, m := range pathParamRe.FindAllStringSubmatch(rt.Path, -1) {
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:     m[1],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+		for _, q := range rt.Query {
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:        q.Name,
+				In:          "query",
+				Description: q.Description,
+				Required:    q.Required,
+				Schema:      &Schema{Type: q.Type},
+			})
+		}
+
+		if rt.Request != nil {
+			ct := rt.ContentType
+			if ct == "" {
+				ct = "application/json"
+			}
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content: map[string]*MediaType{
+					ct: {Schema: g.schemaFor(reflect.TypeOf(rt.Request))},
+				},
+			}
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ok := &Response{Description: http.StatusText(status)}
+		switch {
+		case rt.Stream:
+			ok.Content = map[string]*MediaType{"text/plain": {Schema: &Schema{Type: "string"}}}
+		case rt.Response != nil:
+			ok.Content = map[string]*MediaType{
+				"application/json": {Schema: g.schemaFor(reflect.TypeOf(rt.Response))},
+			}
+		}
+		op.Responses[strconv.Itoa(status)] = ok
+		op.Responses["default"] = &Response{
+			Description: "error",
+			Content:     map[string]*MediaType{"application/json": {Schema: errSchema}},
+		}
+
+		if doc.Paths[rt.Path] == nil {
+			doc.Paths[rt.Path] = make(map[string]*Operation)
+		}
+		doc.Paths[rt.Path][strings.ToLower(rt.Method)] = op
+	}
+
+	doc.Components = &Components{Schemas: g.schemas}
+	return doc
+}
+
+// operationID is the method plus the static path segments, e.g.
+// POST /pods/{namespace}/{name}/restart -> postPodsRestart
+func operationID(rt Route) string {
+	id := strings.ToLower(rt.Method)
+	for _, part := range strings.Split(rt.Path, "/") {
+		if part == "" || strings.HasPrefix(part, "{") {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '-' || r == '.' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+type schemaGen struct {
+	schemas map[string]*Schema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+
+	return &Schema{}
+}
+
+// structSchema registers t under components and returns a ref to it.
+// kubernetes api types are left opaque, their schemas live upstream
+func (g *schemaGen) structSchema(t reflect.Type) *Schema {
+	if strings.HasPrefix(t.PkgPath(), "k8s.io/") {
+		return &Schema{Type: "object", Description: "kubernetes " + t.Name()}
+	}
+
+	ref := &Schema{Ref: "#/components/schemas/" + t.Name()}
+	if _, ok := g.schemas[t.Name()]; ok {
+		return ref
+	}
+
+	sc := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	// register before walking the fields so recursive types terminate
+	g.schemas[t.Name()] = sc
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+
+		fs := g.schemaFor(f.Type)
+		if format := f.Tag.Get("format"); format != "" {
+			fs = &Schema{Type: fs.Type, Format: format}
+		}
+		sc.Properties[name] = fs
+	}
+
+	return ref
+}
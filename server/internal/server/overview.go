@@ -1,15 +1,27 @@
 package server
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime/debug"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	networkingv1 "k8s.io/api/networking/v1"
 
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -50,20 +62,53 @@ type Nodesinfo struct {
 
 	CPUcapacity string `json:"cpucapacity"`
 
-	MemoryCapacity string `json:"memorycapacity"`
-	PodsCapacity   string `json:"podscapacity"`
+	MemoryCapacity string    `json:"memorycapacity"`
+	PodsCapacity   string    `json:"podscapacity"`
+	Allocatable    Resources `json:"allocatable"`
+	// what the pods on the node request, nil while the pods are not loaded
+	Allocation *NodeAllocation `json:"allocation"`
+
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+
+	// roles above joins these, like kubectl get nodes
+	RoleList   []string         `json:"rolelist"`
+	Conditions []*NodeCondition `json:"conditions"`
+	// conditions besides Ready that are not False, e.g. MemoryPressure
+	Pressure      []string `json:"pressure,omitempty"`
+	Taints        []*Taint `json:"taints"`
+	Unschedulable bool     `json:"unschedulable"`
+	Zone          string   `json:"zone,omitempty"`
+	Region        string   `json:"region,omitempty"`
+	InstanceType  string   `json:"instancetype,omitempty"`
 }
 
 type Container struct {
 	Name  string  `json:"name"`
 	Image string  `json:"image"`
 	Ports []*Port `json:"ports"`
+
+	Ready    bool `json:"ready"`
+	Restarts int  `json:"restarts"`
+	// nil until the kubelet reported on the container. lastState is how it
+	// ended the time before, e.g. OOMKilled with exit code 137
+	State     *ContainerState `json:"state,omitempty"`
+	LastState *ContainerState `json:"laststate,omitempty"`
+
+	Requests Resources `json:"requests"`
+	Limits   Resources `json:"limits"`
 }
 
 type Port struct {
+	Name       string `json:"name,omitempty"`
 	Port       int    `json:"port"`
 	TargetPort int    `json:"targetport"`
 	Protocol   string `json:"protocol"`
+	// a named target port, targetPort stays 0 until a pod resolves it
+	TargetPortName string `json:"targetportname,omitempty"`
+	// what the endpoint slices resolved the name to, kept apart so every
+	// snapshot resolves it again from its own pods
+	slicePort int
 }
 
 type Pods struct {
@@ -71,6 +116,8 @@ type Pods struct {
 	RunningPods   map[string]int `json:"running"`
 	PodsList      []*PodsInfo    `json:"pods"`
 	NamespaceList []string       `json:"namespacelist"`
+	// requests and limits per namespace
+	Resources map[string]*NamespaceResources `json:"resources"`
 }
 
 type PodsInfo struct {
@@ -84,6 +131,22 @@ type PodsInfo struct {
 	Containers     []*Container `json:"container"`
 	ReadyContainer int          `json:"readycontainer"`
 	TotalContainer int          `json:"totalcontainer"`
+
+	// status above is yay when the pod is ready. phase and reason are the
+	// pod's own, kubectlStatus is what kubectl get pods shows as STATUS
+	Phase          string       `json:"phase"`
+	Reason         string       `json:"reason,omitempty"`
+	Message        string       `json:"message,omitempty"`
+	KubectlStatus  string       `json:"kubectlstatus"`
+	InitContainers []*Container `json:"initcontainers,omitempty"`
+	QOSClass       string       `json:"qosclass"`
+	Owner          *Owner       `json:"owner,omitempty"`
+	// what the scheduler reserves for the pod, see podResources
+	Requests Resources `json:"requests"`
+	Limits   Resources `json:"limits"`
+
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
 }
 
 type Ingress struct {
@@ -103,6 +166,9 @@ type IngressInfo struct {
 
 	Age   string  `json:"age"`
 	Rules []*Rule `json:"rules"`
+
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
 }
 
 type Rule struct {
@@ -125,6 +191,9 @@ type Services struct {
 	Totalservices map[string]int `json:"total"`
 	NameSpaceList []string       `json:"namespacelist"`
 	ServiceList   []*ServiceInfo `json:"services"`
+	// why the endpoint slices could not be listed, the services are
+	// reported without endpoints then
+	EndpointsError string `json:"endpointserror,omitempty"`
 }
 
 type ServiceInfo struct {
@@ -136,6 +205,15 @@ type ServiceInfo struct {
 	ExternalIP []string          `json:"externalip"`
 	Ports      []*Port           `json:"ports"`
 	Age        string            `json:"age"`
+
+	// nil when the endpoint slices are unknown or the service is an
+	// ExternalName one, which has none
+	Endpoints *ServiceEndpoints `json:"endpoints"`
+	// the pods the selector picks, nil without a selector or pods
+	Pods []string `json:"pods"`
+
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
 }
 
 type NameSpace struct {
@@ -169,6 +247,9 @@ type ConfigMapInfo struct {
 	NameSpace string `json:"namespace"`
 	DataCount int    `json:"datacount"`
 	Age       string `json:"age"`
+
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
 }
 
 // type Deployments struct {
@@ -194,111 +275,263 @@ type Overview struct {
 	Secrets    *Secrets    `json:"secrets"`
 	ConfigMaps *ConfigMaps `json:"configmaps"`
 	// Deployments *Deployments `json:"deployments"`
-	Errors []error
+
+	// how every part loaded. a part that failed keeps what loaded before
+	// in the snapshot, see merge, and is nil when it never loaded
+	Collectors []*CollectorStatus `json:"collectors"`
+	Access     *Access            `json:"access"`
 }
 
-func (s *Server) GetOverview() (*Overview, error) {
+// Access is the part of the cluster the overview covers, see getNamespaces
+// for the scopes
+type Access struct {
+	Scope      string   `json:"scope"`
+	Namespaces []string `json:"namespaces"`
+}
 
-	namespaces, err := s.getNamespaces()
+// CollectorStatus is how one part of the overview loaded. status is ok,
+// forbidden, timeout, unavailable while the cluster's breaker is open, error,
+// or skipped when rbac allows no listing at all or
+// the namespace list it needs failed. namespaces it may not list are left
+// out and named in skippedNamespaces. at is when the refresh that loaded the
+// part started, parts are refreshed on their own schedules
+type CollectorStatus struct {
+	Name              string    `json:"name"`
+	Status            string    `json:"status"`
+	Message           string    `json:"message,omitempty"`
+	At                time.Time `json:"at"`
+	DurationMs        int64     `json:"durationMs"`
+	SkippedNamespaces []string  `json:"skippedNamespaces,omitempty"`
+}
+
+func collectorStatus(name string, start time.Time, err error) *CollectorStatus {
+	c := &CollectorStatus{Name: name, Status: "ok", At: start, DurationMs: time.Since(start).Milliseconds()}
+	var open *circuitOpenError
+	switch {
+	case err == nil:
+		return c
+	case errors.As(err, &open):
+		c.Status = "unavailable"
+	case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+		c.Status = "forbidden"
+	case errors.Is(err, context.DeadlineExceeded) || apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err):
+		c.Status = "timeout"
+	default:
+		c.Status = "error"
+	}
+	c.Message = err.Error()
+	return c
+}
+
+// Collector is the status of the part called name, nil for unknown names
+func (ov *Overview) Collector(name string) *CollectorStatus {
+	for _, c := range ov.Collectors {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Loaded is whether any part loaded, an overview where every collector
+// failed is only kept for the data of an earlier one
+func (ov *Overview) Loaded() bool {
+	return slices.ContainsFunc(ov.Collectors, func(c *CollectorStatus) bool { return c.Status == "ok" })
+}
+
+// Err sums up the parts that failed, nil when everything loaded
+func (ov *Overview) Err() error {
+	var failed []string
+	for _, c := range ov.Collectors {
+		if c.Status != "ok" && c.Status != "skipped" {
+			failed = append(failed, c.Name+": "+c.Message)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(failed, "; "))
+}
+
+// GetOverview runs every collector and keeps what loaded. it only fails when
+// nothing did, otherwise ov.Err says which parts are missing
+func (cl *Cluster) GetOverview(ctx context.Context) (*Overview, error) {
+	ov, err := cl.getOverview(ctx, nil, nil)
 	if err != nil {
 		return nil, err
 	}
+	return ov, nil
+}
 
-	var wg sync.WaitGroup
-	var mux sync.Mutex
-	wg.Add(6)
-	n := make([]string, 0)
-	for _, ns := range namespaces.Items {
-		n = append(n, ns.Name)
-	}
-
-	ov := &Overview{NameSpace: &NameSpace{
-		TotalNamespaces: len(namespaces.Items),
-		NameSpaces:      namespaces,
-		NameSpaceList:   n,
-	}, Errors: make([]error, 0)}
-
-	go func() {
-		defer wg.Done()
-		nodes, err := s.getNodes()
-		mux.Lock()
-		defer mux.Unlock()
-
-		if err != nil {
-			ov.Errors = append(ov.Errors, err)
-		} else {
-			ov.Nodes = nodes
+// getOverview runs the collectors of kinds, all of them when kinds is empty,
+// and returns an overview with only those parts. the namespaced ones go by
+// the namespaces in prev unless the namespaces are collected as well. when
+// nothing loaded the error comes with an overview of just the statuses
+func (cl *Cluster) getOverview(ctx context.Context, kinds []string, prev *Overview) (*Overview, error) {
+	ov := &Overview{}
+	want := func(kind string) bool {
+		return len(kinds) == 0 || slices.Contains(kinds, kind)
+	}
 
+	start := time.Now()
+	var names []string
+	var scope string
+	var nsErr error
+	var nsStatus *CollectorStatus
+	if !want("namespaces") && prev != nil && prev.NameSpace != nil && prev.Access != nil {
+		names, scope = prev.NameSpace.NameSpaceList, prev.Access.Scope
+	} else {
+		var namespaces *v1.NamespaceList
+		namespaces, scope, nsErr = cl.getNamespaces(ctx)
+		if nsErr == nil {
+			names = make([]string, 0)
+			for _, ns := range namespaces.Items {
+				names = append(names, ns.Name)
+			}
+			ov.NameSpace = &NameSpace{
+				TotalNamespaces: len(namespaces.Items),
+				NameSpaces:      namespaces,
+				NameSpaceList:   names,
+			}
+			ov.Access = &Access{Scope: scope, Namespaces: names}
+		}
+		nsStatus = collectorStatus("namespaces", start, nsErr)
+		if scope == "context" {
+			nsStatus.Message = "namespaces can not be listed, only the default namespace is shown"
 		}
+	}
 
-	}()
-	go func() {
-		defer wg.Done()
-		pods, err := s.getPods(namespaces)
-		mux.Lock()
-		defer mux.Unlock()
-		if err != nil {
-			ov.Errors = append(ov.Errors, err)
-		} else {
-			ov.Pods = pods
+	var access map[string]*kindAccess
+	if nsErr == nil {
+		access = cl.access(ctx, names)
+	}
+
+	collectors := cl.collectors(ctx, ov)
+	statuses := make([]*CollectorStatus, len(collectors))
+	errs := make([]error, len(collectors))
+	var wg sync.WaitGroup
+	for i, c := range collectors {
+		if !want(c.name) {
+			continue
 		}
-	}()
-	go func() {
-		defer wg.Done()
-		svc, err := s.getServices(namespaces)
-		mux.Lock()
-		defer mux.Unlock()
-
-		if err != nil {
-			ov.Errors = append(ov.Errors, err)
-		} else {
-			ov.Services = svc
+		if nsErr != nil {
+			if c.namespaced {
+				statuses[i] = &CollectorStatus{Name: c.name, Status: "skipped", Message: "needs the namespace list", At: start}
+				errs[i] = nsErr
+				continue
+			}
+		} else if ka := access[c.name]; !ka.all && len(ka.allowed) == 0 {
+			statuses[i] = &CollectorStatus{Name: c.name, Status: "skipped", Message: "no access to list " + c.name, At: start, SkippedNamespaces: ka.skipped}
+			continue
 		}
 
-	}()
-	go func() {
-		defer wg.Done()
-		ing, err := s.getIngress(namespaces)
-		mux.Lock()
-		defer mux.Unlock()
-		if err != nil {
-			ov.Errors = append(ov.Errors, err)
-		} else {
-			ov.Ingress = ing
-		}
-	}()
-	go func() {
-		defer wg.Done()
-		sec, err := s.getSecrets(namespaces)
-		mux.Lock()
-		defer mux.Unlock()
-		if err != nil {
-			ov.Errors = append(ov.Errors, err)
-		} else {
-			ov.Secrets = sec
+		var ls listScope
+		var skipped []string
+		if ka := access[c.name]; ka != nil {
+			ls, skipped = cl.listScope(ka, scope), ka.skipped
 		}
+		wg.Go(func() {
+			errs[i] = c.safeRun(ls)
+			statuses[i] = collectorStatus(c.name, start, errs[i])
+			statuses[i].SkippedNamespaces = skipped
+		})
+	}
+	wg.Wait()
 
-	}()
-	go func() {
-		defer wg.Done()
-		m, err := s.getConfigMaps(namespaces)
-		mux.Lock()
-		defer mux.Unlock()
-		if err != nil {
-			ov.Errors = append(ov.Errors, err)
+	loaded := nsStatus != nil && nsErr == nil
+	if nsStatus != nil {
+		ov.Collectors = append(ov.Collectors, nsStatus)
+	}
+	var failed []error
+	for i, c := range statuses {
+		if c == nil {
+			continue
+		}
+		ov.Collectors = append(ov.Collectors, c)
+		if errs[i] == nil {
+			loaded = true
 		} else {
-			ov.ConfigMaps = m
+			failed = append(failed, errs[i])
 		}
+	}
+
+	if loaded || len(failed) == 0 {
+		return ov, nil
+	}
+	// nothing loaded, the namespace error is the one worth answering with.
+	// the overview still says how each part failed
+	if nsErr != nil {
+		return ov, nsErr
+	}
+	return ov, errors.Join(failed...)
+}
 
+// collector loads one part of an overview
+type collector struct {
+	name       string
+	namespaced bool
+	run        func(ls listScope) error
+}
+
+// safeRun runs the collector, a panic in one fails it alone instead of the
+// whole process
+func (c collector) safeRun(ls listScope) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("collector %s panicked: %v\n%s", c.name, r, debug.Stack())
+			err = fmt.Errorf("collector panicked: %v", r)
+		}
 	}()
+	return c.run(ls)
+}
 
-	wg.Wait()
-	if len(ov.Errors) > 0 {
-		return nil, ov.Errors[0]
+// collectors load the parts of ov besides the namespaces. every one sets its
+// own field, so they need no lock between them
+func (cl *Cluster) collectors(ctx context.Context, ov *Overview) []collector {
+	return []collector{
+		{"nodes", false, func(listScope) (err error) { ov.Nodes, err = cl.getNodes(ctx); return }},
+		{"pods", true, func(ls listScope) (err error) { ov.Pods, err = cl.getPods(ctx, ls); return }},
+		{"services", true, func(ls listScope) (err error) { ov.Services, err = cl.getServices(ctx, ls); return }},
+		{"ingress", true, func(ls listScope) (err error) { ov.Ingress, err = cl.getIngress(ctx, ls); return }},
+		{"secrets", true, func(ls listScope) (err error) { ov.Secrets, err = cl.getSecrets(ctx, ls); return }},
+		{"configmaps", true, func(ls listScope) (err error) { ov.ConfigMaps, err = cl.getConfigMaps(ctx, ls); return }},
 	}
+}
 
-	return ov, nil
+// merge is a copy of ov with the parts collected in part swapped in, the
+// other parts and their statuses stay as they were. a part that failed only
+// swaps its status, what loaded before is still better than nothing
+func (ov *Overview) merge(part *Overview) *Overview {
+	next := *ov
+	next.Collectors = slices.Clone(ov.Collectors)
+	for _, c := range part.Collectors {
+		if c.Status == "ok" {
+			switch c.Name {
+			case "namespaces":
+				next.NameSpace, next.Access = part.NameSpace, part.Access
+			case "nodes":
+				next.Nodes = part.Nodes
+			case "pods":
+				next.Pods = part.Pods
+			case "services":
+				next.Services = part.Services
+			case "ingress":
+				next.Ingress = part.Ingress
+			case "secrets":
+				next.Secrets = part.Secrets
+			case "configmaps":
+				next.ConfigMaps = part.ConfigMaps
+			}
+		}
 
+		i := slices.IndexFunc(next.Collectors, func(prev *CollectorStatus) bool { return prev.Name == c.Name })
+		if i < 0 {
+			next.Collectors = append(next.Collectors, c)
+		} else {
+			next.Collectors[i] = c
+		}
+	}
+	return &next
 }
 
 func NewClientSet(c *rest.Config) (*kubernetes.Clientset, error) {
@@ -311,25 +544,69 @@ func NewClientSet(c *rest.Config) (*kubernetes.Clientset, error) {
 
 }
 
-func (s *Server) getNamespaces() (*v1.NamespaceList, error) {
+// getNamespaces returns the namespaces to collect from and the scope they
+// cover: declared when the cluster was registered with its namespaces, cluster
+// when every namespace could be listed, or context when the credentials may
+// not list namespaces and only the default namespace is known
+func (cl *Cluster) getNamespaces(ctx context.Context) (*v1.NamespaceList, string, error) {
+	if len(cl.Namespaces) > 0 {
+		return namespaceList(cl.Namespaces), "declared", nil
+	}
+
+	namespaces := &v1.NamespaceList{}
+	err := cl.listPaged(ctx, "", func(ctx context.Context, _ string, opts metav1.ListOptions) (runtime.Object, error) {
+		return cl.ClientSet.CoreV1().Namespaces().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		namespaces.Items = append(namespaces.Items, *obj.(*v1.Namespace))
+		return nil
+	})
+	if err == nil {
+		return namespaces, "cluster", nil
+	}
+	if ns := cl.defaultNamespace(); apierrors.IsForbidden(err) && ns != "" {
+		return namespaceList([]string{ns}), "context", nil
+	}
+	return nil, "", err
+}
+
+// namespaceList stands in for a listed one when only the names are known
+func namespaceList(names []string) *v1.NamespaceList {
+	list := &v1.NamespaceList{}
+	for _, n := range names {
+		list.Items = append(list.Items, v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: n}})
+	}
+	return list
+}
 
-	namespaces, err := s.ClientSet.CoreV1().Namespaces().List(context.Background(), metav1.ListOptions{})
+// defaultNamespace is the kubeconfig context's namespace, or the service
+// account's in-cluster
+func (cl *Cluster) defaultNamespace() string {
+	if cl.kubeconfig != nil {
+		return cl.kubeconfig.namespace
+	}
+	b, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
 	if err != nil {
-		return nil, err
+		return ""
 	}
-	return namespaces, nil
+	return strings.TrimSpace(string(b))
 }
 
-func (s *Server) getNodes() (*Nodes, error) {
+func (cl *Cluster) getNodes(ctx context.Context) (*Nodes, error) {
 
-	nodes, err := s.ClientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	var nodes []*v1.Node
+	err := cl.listPaged(ctx, "", func(ctx context.Context, _ string, opts metav1.ListOptions) (runtime.Object, error) {
+		return cl.ClientSet.CoreV1().Nodes().List(ctx, opts)
+	}, func(obj runtime.Object) error {
+		nodes = append(nodes, obj.(*v1.Node))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 	var arr []*Nodesinfo
 
 	runningNodes := 0
-	for _, node := range nodes.Items {
+	for _, node := range nodes {
 		var n *Nodesinfo
 
 		// node status
@@ -359,9 +636,13 @@ func (s *Server) getNodes() (*Nodes, error) {
 		duration := time.Since(node.CreationTimestamp.Time)
 		age := strconv.FormatFloat(duration.Hours(), 'f', -1, 64)
 
+		roles := nodeRoles(node.Labels)
+		conditions := nodeConditions(node)
+
 		n = &Nodesinfo{
 			Name:           node.Name,
 			Status:         status,
+			Roles:          strings.Join(roles, ","),
 			Age:            age,
 			Version:        node.Status.NodeInfo.KubeletVersion,
 			InternalIP:     addrs,
@@ -371,51 +652,49 @@ func (s *Server) getNodes() (*Nodes, error) {
 			CPUcapacity:    node.Status.Allocatable.Cpu().String(),
 			MemoryCapacity: node.Status.Allocatable.Memory().String(),
 			PodsCapacity:   node.Status.Allocatable.Pods().String(),
+			Allocatable:    resources(node.Status.Allocatable),
+
+			RoleList:      roles,
+			Conditions:    conditions,
+			Pressure:      nodePressure(conditions),
+			Taints:        nodeTaints(node),
+			Unschedulable: node.Spec.Unschedulable,
+			Zone:          label(node.Labels, labelZone, labelZoneBeta),
+			Region:        label(node.Labels, labelRegion, labelRegionBeta),
+			InstanceType:  label(node.Labels, labelInstanceType, labelInstanceTypeBeta),
+			Labels:        node.Labels,
+			Annotations:   node.Annotations,
 		}
 
 		arr = append(arr, n)
 
 	}
 
-	return &Nodes{TotalNodes: len(nodes.Items), RunningNodes: runningNodes, Nodes: arr}, nil
+	return &Nodes{TotalNodes: len(nodes), RunningNodes: runningNodes, Nodes: arr}, nil
 }
 
-func (s *Server) getPods(namespaces *v1.NamespaceList) (*Pods, error) {
+func (cl *Cluster) getPods(ctx context.Context, scope listScope) (*Pods, error) {
+	items, err := listItems[v1.Pod](ctx, cl, scope, func(ctx context.Context, ns string, opts metav1.ListOptions) (runtime.Object, error) {
+		return cl.ClientSet.CoreV1().Pods(ns).List(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	var arr []*PodsInfo
 	totalPods := make(map[string]int)
 	runPods := make(map[string]int)
+	usage := make(map[string]*NamespaceResources)
 
-	runningPods := 0
-
-	for _, ns := range namespaces.Items {
+	for _, ns := range scope.namespaces {
 		r := 0
-		l := 0
-
-		pods, err := s.ClientSet.CoreV1().Pods(ns.Name).List(context.Background(), metav1.ListOptions{})
-
-		if err != nil {
-			return nil, err
-		}
+		nr := &NamespaceResources{}
 
-		l = l + len(pods.Items)
-
-		for _, pod := range pods.Items {
-
-			var p *PodsInfo
-
-			// status
+		for _, pod := range items[ns] {
 			status := "nah"
-
-			// running pods
-
-			for _, condition := range pod.Status.Conditions {
-				if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
-					status = "yay"
-					r++
-					runningPods++
-					break
-				}
+			if podReady(pod) {
+				status = "yay"
+				r++
 			}
 
 			// age
@@ -423,138 +702,160 @@ func (s *Server) getPods(namespaces *v1.NamespaceList) (*Pods, error) {
 			duration := time.Since(pod.CreationTimestamp.Time)
 			age := strconv.FormatFloat(duration.Hours(), 'f', -1, 64)
 
-			// containers
+			conts := containers(pod.Spec.Containers, pod.Status.ContainerStatuses)
 
-			var containers []*Container
+			// restarts, ready containers and total containers
 
-			for _, cont := range pod.Spec.Containers {
-				// ports
-
-				var ports []*Port
-				for _, port := range cont.Ports {
-					ports = append(ports, &Port{
-						Port:     int(port.ContainerPort),
-						Protocol: string(port.Protocol),
-					})
+			restarts, ready := 0, 0
+			for _, c := range conts {
+				restarts += c.Restarts
+				if c.Ready {
+					ready++
 				}
-
-				containers = append(containers, &Container{
-					Name:  cont.Name,
-					Image: cont.Image,
-					Ports: ports,
-				})
-			}
-
-			// restarts
-
-			restarts := int32(0)
-			for _, status := range pod.Status.ContainerStatuses {
-				restarts += status.RestartCount
 			}
 
-			// ready containers and total containers
-
-			ready := 0
-			total := len(pod.Status.ContainerStatuses)
-			for _, status := range pod.Status.ContainerStatuses {
-				if status.Ready {
-					ready++
+			requests, limits := podResources(pod)
+			if !podFinished(pod) {
+				nr.Requests = nr.Requests.add(requests)
+				nr.Limits = nr.Limits.add(limits)
+				for _, c := range conts {
+					nr.Containers++
+					if c.Requests.CPU == 0 && c.Requests.Memory == 0 {
+						nr.WithoutRequests++
+					}
+					if c.Limits.CPU == 0 && c.Limits.Memory == 0 {
+						nr.WithoutLimits++
+					}
 				}
 			}
 
-			p = &PodsInfo{
+			arr = append(arr, &PodsInfo{
 				Name:           pod.Name,
-				NameSpace:      ns.Name,
+				NameSpace:      ns,
 				Status:         status,
-				Restarts:       int(restarts),
+				Restarts:       restarts,
 				IP:             pod.Status.PodIP,
 				Age:            age,
-				Containers:     containers,
+				Containers:     conts,
 				Node:           pod.Spec.NodeName,
 				ReadyContainer: ready,
-				TotalContainer: total,
-			}
-
-			arr = append(arr, p)
-
+				TotalContainer: len(pod.Status.ContainerStatuses),
+				Labels:         pod.Labels,
+				Annotations:    pod.Annotations,
+
+				Phase:          string(pod.Status.Phase),
+				Reason:         pod.Status.Reason,
+				Message:        pod.Status.Message,
+				KubectlStatus:  kubectlStatus(pod),
+				InitContainers: containers(pod.Spec.InitContainers, pod.Status.InitContainerStatuses),
+				QOSClass:       string(pod.Status.QOSClass),
+				Owner:          podOwner(pod),
+				Requests:       requests,
+				Limits:         limits,
+			})
 		}
-		runPods[ns.Name] = r
-		totalPods[ns.Name] = l
-
+		runPods[ns] = r
+		totalPods[ns] = len(items[ns])
+		usage[ns] = nr
 	}
 
-	return &Pods{TotalPods: totalPods, RunningPods: runPods, PodsList: arr}, nil
+	return &Pods{TotalPods: totalPods, RunningPods: runPods, PodsList: arr, Resources: usage}, nil
 }
 
-func (s *Server) getServices(namespaces *v1.NamespaceList) (*Services, error) {
+func (cl *Cluster) getServices(ctx context.Context, scope listScope) (*Services, error) {
+	items, err := listItems[v1.Service](ctx, cl, scope, func(ctx context.Context, ns string, opts metav1.ListOptions) (runtime.Object, error) {
+		return cl.ClientSet.CoreV1().Services(ns).List(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// services are still worth showing when their slices can not be listed
+	endpoints, epErr := cl.getEndpointSlices(ctx, scope)
 
 	total := make(map[string]int)
 	// ser := make(map[string]*v1.ServiceList)
 	Svc := make([]*ServiceInfo, 0)
-	for _, ns := range namespaces.Items {
+	for _, ns := range scope.namespaces {
 
 		l := 0
 
-		svc, err := s.ClientSet.CoreV1().Services(ns.Name).List(context.Background(), metav1.ListOptions{})
-		if err != nil {
-			return nil, err
-		}
-
-		for _, ser := range svc.Items {
+		for _, ser := range items[ns] {
 
 			// age
 			duration := time.Since(ser.CreationTimestamp.Time)
 			age := strconv.FormatFloat(duration.Hours(), 'f', -1, 64)
 
+			var eps *ServiceEndpoints
+			var resolved map[string]int
+			if epErr == nil && ser.Spec.Type != v1.ServiceTypeExternalName {
+				eps, resolved = serviceEndpoints(endpoints[ns][ser.Name])
+			}
+
 			// ports
 			var ports []*Port
 			for _, port := range ser.Spec.Ports {
-				ports = append(ports, &Port{
+				p := &Port{
+					Name:       port.Name,
 					Port:       int(port.Port),
 					TargetPort: int(port.TargetPort.IntVal),
 					Protocol:   string(port.Protocol),
-				})
+				}
+				if port.TargetPort.Type == intstr.String {
+					p.TargetPortName = port.TargetPort.StrVal
+					p.slicePort = resolved[port.Name]
+					p.TargetPort = p.slicePort
+				}
+				ports = append(ports, p)
 			}
 
 			x := &ServiceInfo{
-				Name:       ser.Name,
-				Namespace:  ser.Namespace,
-				Age:        age,
-				ClusterIP:  ser.Spec.ClusterIPs,
-				Type:       string(ser.Spec.Type),
-				Ports:      ports,
-				Selector:   ser.Spec.Selector,
-				ExternalIP: ser.Spec.ExternalIPs,
+				Name:        ser.Name,
+				Namespace:   ser.Namespace,
+				Age:         age,
+				ClusterIP:   ser.Spec.ClusterIPs,
+				Type:        string(ser.Spec.Type),
+				Ports:       ports,
+				Selector:    ser.Spec.Selector,
+				ExternalIP:  ser.Spec.ExternalIPs,
+				Endpoints:   eps,
+				Labels:      ser.Labels,
+				Annotations: ser.Annotations,
 			}
 
 			Svc = append(Svc, x)
 
 		}
 
-		l = l + len(svc.Items)
-		// ser[ns.Name] = svc
+		l = l + len(items[ns])
+		// ser[ns] = svc
 
-		total[ns.Name] = l
+		total[ns] = l
 
 	}
 
-	return &Services{Totalservices: total, ServiceList: Svc}, nil
+	res := &Services{Totalservices: total, ServiceList: Svc}
+	if epErr != nil {
+		res.EndpointsError = epErr.Error()
+	}
+	return res, nil
 }
 
-func (s *Server) getIngress(namespace *v1.NamespaceList) (*Ingress, error) {
+func (cl *Cluster) getIngress(ctx context.Context, scope listScope) (*Ingress, error) {
+	items, err := listItems[networkingv1.Ingress](ctx, cl, scope, func(ctx context.Context, ns string, opts metav1.ListOptions) (runtime.Object, error) {
+		return cl.ClientSet.NetworkingV1().Ingresses(ns).List(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	total := make(map[string]int)
 	// Ing := make(map[string]*networkingv1.IngressList)
 	ing := make([]*IngressInfo, 0)
-	for _, ns := range namespace.Items {
+	for _, ns := range scope.namespaces {
 		length := 0
-		ingress, err := s.ClientSet.NetworkingV1().Ingresses(ns.Name).List(context.Background(), metav1.ListOptions{})
 
-		if err != nil {
-			return nil, err
-		}
-
-		for _, i := range ingress.Items {
+		for _, i := range items[ns] {
 
 			// age
 			duration := time.Since(i.CreationTimestamp.Time)
@@ -567,16 +868,21 @@ func (s *Server) getIngress(namespace *v1.NamespaceList) (*Ingress, error) {
 			for _, rule := range i.Spec.Rules {
 				// paths
 				hey := make([]*Path, 0)
-				for _, path := range rule.HTTP.Paths {
-					hey = append(hey, &Path{
-						Path:     path.Path,
-						PathType: string(*path.PathType),
-						Backend: &Backend{
-							Name: path.Backend.Service.Name,
-							Port: int(path.Backend.Service.Port.Number),
-						},
-					})
-
+				// a rule without http only names a host
+				var paths []networkingv1.HTTPIngressPath
+				if rule.HTTP != nil {
+					paths = rule.HTTP.Paths
+				}
+				for _, path := range paths {
+					p := &Path{Path: path.Path}
+					if path.PathType != nil {
+						p.PathType = string(*path.PathType)
+					}
+					// resource backends have no service
+					if svc := path.Backend.Service; svc != nil {
+						p.Backend = &Backend{Name: svc.Name, Port: int(svc.Port.Number)}
+					}
+					hey = append(hey, p)
 				}
 				h = append(h, rule.Host)
 				kitty = append(kitty, &Rule{
@@ -586,44 +892,55 @@ func (s *Server) getIngress(namespace *v1.NamespaceList) (*Ingress, error) {
 
 			}
 
+			// no address until the controller has picked the ingress up, some
+			// load balancers only give a hostname
+			var address string
+			if lb := i.Status.LoadBalancer.Ingress; len(lb) > 0 {
+				address = cmp.Or(lb[0].IP, lb[0].Hostname)
+			}
+
 			meow := &IngressInfo{
-				Name:      i.Name,
-				Namespace: i.Namespace,
-				Age:       age,
-				Rules:     kitty,
-				Hosts:     h,
-				Address:   i.Status.LoadBalancer.Ingress[0].IP,
+				Name:        i.Name,
+				Namespace:   i.Namespace,
+				Age:         age,
+				Rules:       kitty,
+				Hosts:       h,
+				Address:     address,
+				Labels:      i.Labels,
+				Annotations: i.Annotations,
 			}
 
 			ing = append(ing, meow)
 
 		}
 
-		length = length + len(ingress.Items)
+		length = length + len(items[ns])
 
-		total[ns.Name] = length
-		// Ing[ns.Name] = ingress
+		total[ns] = length
+		// Ing[ns] = ingress
 	}
 
 	return &Ingress{TotalIngress: total, IngressList: ing}, nil
 
 }
 
-func (s *Server) getSecrets(namespace *v1.NamespaceList) (*Secrets, error) {
+func (cl *Cluster) getSecrets(ctx context.Context, scope listScope) (*Secrets, error) {
+	items, err := listItems[v1.Secret](ctx, cl, scope, func(ctx context.Context, ns string, opts metav1.ListOptions) (runtime.Object, error) {
+		return cl.ClientSet.CoreV1().Secrets(ns).List(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	x := make(map[string]int)
 
 	// Sec := make(map[string]*v1.SecretList)
 	secrets := make([]*SecretsInfo, 0)
 
-	for _, ns := range namespace.Items {
+	for _, ns := range scope.namespaces {
 		length := 0
-		sec, err := s.ClientSet.CoreV1().Secrets(ns.Name).List(context.Background(), metav1.ListOptions{})
-		if err != nil {
-			return nil, err
-		}
 
-		for _, secret := range sec.Items {
+		for _, secret := range items[ns] {
 			// age
 			duration := time.Since(secret.CreationTimestamp.Time)
 			age := strconv.FormatFloat(duration.Hours(), 'f', -1, 64)
@@ -639,10 +956,10 @@ func (s *Server) getSecrets(namespace *v1.NamespaceList) (*Secrets, error) {
 			secrets = append(secrets, a)
 		}
 
-		length = length + len(sec.Items)
-		x[ns.Name] = length
+		length = length + len(items[ns])
+		x[ns] = length
 
-		// Sec[ns.Name] = sec
+		// Sec[ns] = sec
 
 	}
 
@@ -650,36 +967,40 @@ func (s *Server) getSecrets(namespace *v1.NamespaceList) (*Secrets, error) {
 
 }
 
-func (s *Server) getConfigMaps(namespace *v1.NamespaceList) (*ConfigMaps, error) {
+func (cl *Cluster) getConfigMaps(ctx context.Context, scope listScope) (*ConfigMaps, error) {
+	items, err := listItems[v1.ConfigMap](ctx, cl, scope, func(ctx context.Context, ns string, opts metav1.ListOptions) (runtime.Object, error) {
+		return cl.ClientSet.CoreV1().ConfigMaps(ns).List(ctx, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	x := make(map[string]int)
 
 	kitty := make([]*ConfigMapInfo, 0)
-	for _, ns := range namespace.Items {
+	for _, ns := range scope.namespaces {
 
 		l := 0
-		m, err := s.ClientSet.CoreV1().ConfigMaps(ns.Name).List(context.Background(), metav1.ListOptions{})
-		if err != nil {
-			return nil, err
-		}
 
-		for _, meow := range m.Items {
+		for _, meow := range items[ns] {
 
 			duration := time.Since(meow.CreationTimestamp.Time)
 			age := strconv.FormatFloat(duration.Hours(), 'f', -1, 64)
 
 			suck := &ConfigMapInfo{
-				Name:      meow.Name,
-				NameSpace: meow.Namespace,
-				Age:       age,
-				DataCount: len(meow.Data),
+				Name:        meow.Name,
+				NameSpace:   meow.Namespace,
+				Age:         age,
+				DataCount:   len(meow.Data),
+				Labels:      meow.Labels,
+				Annotations: meow.Annotations,
 			}
 
 			kitty = append(kitty, suck)
 		}
 
-		l = l + len(m.Items)
-		x[ns.Name] = l
+		l = l + len(items[ns])
+		x[ns] = l
 
 	}
 
@@ -687,8 +1008,28 @@ func (s *Server) getConfigMaps(namespace *v1.NamespaceList) (*ConfigMaps, error)
 
 }
 
-func (s *Server) DeletePod(ns string, name string) error {
-	err := s.ClientSet.CoreV1().Pods(ns).Delete(context.Background(), name, metav1.DeleteOptions{})
+type LogOptions struct {
+	Container string
+	Follow    bool
+	TailLines int64
+}
+
+// PodLogs opens the log stream of a pod, the caller closes it. with Follow it
+// stays open until ctx is done
+func (cl *Cluster) PodLogs(ctx context.Context, ns, name string, opts LogOptions) (io.ReadCloser, error) {
+	o := &v1.PodLogOptions{
+		Container: opts.Container,
+		Follow:    opts.Follow,
+	}
+	if opts.TailLines > 0 {
+		o.TailLines = &opts.TailLines
+	}
+
+	return cl.ClientSet.CoreV1().Pods(ns).GetLogs(name, o).Stream(ctx)
+}
+
+func (cl *Cluster) DeletePod(ctx context.Context, ns string, name string) error {
+	err := cl.ClientSet.CoreV1().Pods(ns).Delete(ctx, name, metav1.DeleteOptions{})
 	return err
 
 }
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"server/internal/store"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// uploaded clusters are saved encrypted under dataDir/clusters so they come
+// back after a restart. the startup cluster comes from the config and is not
+// saved
+
+// storedCluster is what is kept of a cluster between restarts
+type storedCluster struct {
+	Name       string            `json:"name"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Kubeconfig []byte            `json:"kubeconfig"`
+	Context    string            `json:"context"`
+	Namespace  string            `json:"namespace,omitempty"`
+	Namespaces []string          `json:"namespaces,omitempty"`
+}
+
+// OpenStore reads the master secrets and opens the saved clusters. the
+// session key is derived from the secret too so it survives restarts. with
+// no secret configured nothing is saved
+func (s *Server) OpenStore() error {
+	cfg := s.Config()
+	if !cfg.Store.Enabled() {
+		return nil
+	}
+
+	current, err := os.ReadFile(cfg.Store.SecretFile)
+	if err != nil {
+		return err
+	}
+	var previous [][]byte
+	for _, f := range cfg.Store.PreviousSecretFiles {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		previous = append(previous, b)
+	}
+
+	keys, err := store.NewKeyring(current, previous...)
+	if err != nil {
+		return err
+	}
+	st, err := store.Open(filepath.Join(cfg.DataDir, "clusters"), keys)
+	if err != nil {
+		return err
+	}
+	sessionKey, err := keys.Derive("kube monitering session key")
+	if err != nil {
+		return err
+	}
+
+	s.SessionKey = sessionKey
+	s.store = st
+	return nil
+}
+
+// save writes cl to the store, failures are logged since the cluster is
+// connected either way
+func (s *Server) save(cl *Cluster) {
+	if s.store == nil || cl.kubeconfig == nil || !cl.kubeconfig.uploaded {
+		return
+	}
+
+	kc, err := clientcmd.Write(*cl.kubeconfig.raw)
+	if err != nil {
+		log.Printf("saving cluster %s: %v", cl.Name, err)
+		return
+	}
+	b, err := json.Marshal(&storedCluster{
+		Name:       cl.Name,
+		Labels:     cl.Labels,
+		Kubeconfig: kc,
+		Context:    cl.kubeconfig.context,
+		Namespace:  cl.kubeconfig.namespace,
+		Namespaces: cl.Namespaces,
+	})
+	if err != nil {
+		log.Printf("saving cluster %s: %v", cl.Name, err)
+		return
+	}
+	if err := s.store.Put(cl.Name, b); err != nil {
+		log.Printf("saving cluster %s: %v", cl.Name, err)
+	}
+}
+
+// forget deletes the saved copy of a cluster, reporting whether there was one
+func (s *Server) forget(name string) (bool, error) {
+	if s.store == nil {
+		return false, nil
+	}
+	err := s.store.Delete(name)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// restore builds the cluster saved as name without connecting it
+func (s *Server) restore(name string) (*Cluster, error) {
+	b, _, err := s.store.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	var sc storedCluster
+	if err := json.Unmarshal(b, &sc); err != nil {
+		return nil, err
+	}
+	raw, err := parseKubeconfig(sc.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// checked again, the upload policy may have been tightened since
+	reg := &ClusterRegistration{Name: name, Labels: sc.Labels, Context: sc.Context, Namespace: sc.Namespace, Namespaces: sc.Namespaces}
+	return s.clusterFromKubeconfig(raw, true, reg)
+}
+
+// RestoreClusters re-encrypts clusters saved with a previous secret and then
+// connects all saved clusters, each retrying like the startup cluster. it
+// returns once they are connected or ctx is done
+func (s *Server) RestoreClusters(ctx context.Context) {
+	if s.store == nil {
+		return
+	}
+
+	n, err := s.store.Rotate()
+	if n > 0 {
+		log.Printf("re-encrypted %d saved clusters with the current secret", n)
+	}
+	if err != nil {
+		log.Printf("rotating saved clusters: %v", err)
+	}
+
+	entries, err := s.store.List()
+	if err != nil {
+		log.Printf("saved clusters: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		if e.Error != "" {
+			log.Printf("saved cluster %s: %s", e.Name, e.Error)
+			continue
+		}
+		cl, err := s.restore(e.Name)
+		if err != nil {
+			log.Printf("saved cluster %s: %v", e.Name, err)
+			continue
+		}
+		wg.Go(func() { s.connectWithRetry(ctx, cl, cl.RestConfig.Host) })
+	}
+	wg.Wait()
+}
+
+func (s *Server) apiStoredClusters(w http.ResponseWriter, r *http.Request) {
+	res := &StoredClustersResponse{Clusters: make([]*StoredCluster, 0)}
+	if s.store == nil {
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+
+	entries, err := s.store.List()
+	if err != nil {
+		writeErr(w, fmt.Errorf("listing saved clusters: %w", err))
+		return
+	}
+	res.Enabled = true
+	res.KeyID = s.store.KeyID()
+	for _, e := range entries {
+		res.Clusters = append(res.Clusters, &StoredCluster{
+			Name:      e.Name,
+			KeyID:     e.KeyID,
+			SavedAt:   e.SavedAt,
+			Stale:     e.Stale,
+			Error:     e.Error,
+			Connected: s.Cluster(e.Name) != nil,
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// apiForgetStoredCluster deletes the saved copy only, a connected cluster
+// stays until it is removed or the server restarts
+func (s *Server) apiForgetStoredCluster(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := validClusterName(name); err != nil {
+		writeErr(w, err)
+		return
+	}
+	ok, err := s.forget(name)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "no saved cluster named %q", name)
+		return
+	}
+	writeJSON(w, http.StatusOK, &MessageResponse{Message: "forgotten"})
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ContainerState is what a container is doing, or did last time it ran.
+// state is waiting, running or terminated
+type ContainerState struct {
+	State      string    `json:"state"`
+	Reason     string    `json:"reason,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	ExitCode   int       `json:"exitcode"`
+	Signal     int       `json:"signal,omitempty"`
+	StartedAt  time.Time `json:"startedat,omitzero"`
+	FinishedAt time.Time `json:"finishedat,omitzero"`
+}
+
+// Owner is the controller a pod belongs to, e.g. a ReplicaSet or a Job
+type Owner struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+func containerState(s v1.ContainerState) *ContainerState {
+	switch {
+	case s.Waiting != nil:
+		return &ContainerState{State: "waiting", Reason: s.Waiting.Reason, Message: s.Waiting.Message}
+	case s.Running != nil:
+		return &ContainerState{State: "running", StartedAt: s.Running.StartedAt.Time}
+	case s.Terminated != nil:
+		t := s.Terminated
+		return &ContainerState{
+			State:      "terminated",
+			Reason:     t.Reason,
+			Message:    t.Message,
+			ExitCode:   int(t.ExitCode),
+			Signal:     int(t.Signal),
+			StartedAt:  t.StartedAt.Time,
+			FinishedAt: t.FinishedAt.Time,
+		}
+	}
+	return nil
+}
+
+// containers pairs the spec of every container with its status, matched by
+// name since the status list may be missing or in another order
+func containers(specs []v1.Container, statuses []v1.ContainerStatus) []*Container {
+	byName := make(map[string]v1.ContainerStatus, len(statuses))
+	for _, st := range statuses {
+		byName[st.Name] = st
+	}
+
+	var out []*Container
+	for _, cont := range specs {
+		var ports []*Port
+		for _, port := range cont.Ports {
+			ports = append(ports, &Port{
+				Name:     port.Name,
+				Port:     int(port.ContainerPort),
+				Protocol: string(port.Protocol),
+			})
+		}
+
+		c := &Container{
+			Name:     cont.Name,
+			Image:    cont.Image,
+			Ports:    ports,
+			Requests: resources(cont.Resources.Requests),
+			Limits:   resources(cont.Resources.Limits),
+		}
+		if st, ok := byName[cont.Name]; ok {
+			c.Ready = st.Ready
+			c.Restarts = int(st.RestartCount)
+			c.State = containerState(st.State)
+			c.LastState = containerState(st.LastTerminationState)
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func podOwner(pod *v1.Pod) *Owner {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			return &Owner{Kind: ref.Kind, Name: ref.Name}
+		}
+	}
+	return nil
+}
+
+// kubectlStatus is the STATUS column of kubectl get pods: the phase unless
+// an init container, a container or the pod itself has a better reason,
+// like Init:0/2, CrashLoopBackOff, OOMKilled, Completed or Terminating
+func kubectlStatus(pod *v1.Pod) string {
+	reason := string(pod.Status.Phase)
+	if pod.Status.Reason != "" {
+		reason = pod.Status.Reason
+	}
+
+	initializing := false
+	for i, st := range pod.Status.InitContainerStatuses {
+		t, w := st.State.Terminated, st.State.Waiting
+		switch {
+		case t != nil && t.ExitCode == 0:
+			continue
+		case isSidecar(pod, st.Name) && st.Started != nil && *st.Started:
+			continue
+		case t != nil:
+			switch {
+			case t.Reason != "":
+				reason = "Init:" + t.Reason
+			case t.Signal != 0:
+				reason = fmt.Sprintf("Init:Signal:%d", t.Signal)
+			default:
+				reason = fmt.Sprintf("Init:ExitCode:%d", t.ExitCode)
+			}
+		case w != nil && w.Reason != "" && w.Reason != "PodInitializing":
+			reason = "Init:" + w.Reason
+		default:
+			reason = fmt.Sprintf("Init:%d/%d", i, len(pod.Spec.InitContainers))
+		}
+		initializing = true
+		break
+	}
+
+	if !initializing {
+		hasRunning := false
+		// the first container's reason wins, like in kubectl
+		for i := len(pod.Status.ContainerStatuses) - 1; i >= 0; i-- {
+			st := pod.Status.ContainerStatuses[i]
+			t, w := st.State.Terminated, st.State.Waiting
+			switch {
+			case w != nil && w.Reason != "":
+				reason = w.Reason
+			case t != nil && t.Reason != "":
+				reason = t.Reason
+			case t != nil && t.Signal != 0:
+				reason = fmt.Sprintf("Signal:%d", t.Signal)
+			case t != nil:
+				reason = fmt.Sprintf("ExitCode:%d", t.ExitCode)
+			case st.Ready && st.State.Running != nil:
+				hasRunning = true
+			}
+		}
+
+		// a pod with one container done and another still serving runs
+		if reason == "Completed" && hasRunning {
+			reason = "NotReady"
+			if podReady(pod) {
+				reason = "Running"
+			}
+		}
+	}
+
+	if pod.DeletionTimestamp != nil {
+		if pod.Status.Reason == "NodeLost" {
+			return "Unknown"
+		}
+		return "Terminating"
+	}
+	return reason
+}
+
+// isSidecar is whether the init container called name keeps running next
+// to the others, its restart policy is Always
+func isSidecar(pod *v1.Pod, name string) bool {
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == name {
+			return c.RestartPolicy != nil && *c.RestartPolicy == v1.ContainerRestartPolicyAlways
+		}
+	}
+	return false
+}
+
+func podReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
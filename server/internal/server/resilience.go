@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// every call the collectors make goes through Cluster.call, which retries
+// what may work on another try and stops calling a cluster that keeps failing
+// so a dead api server doesnt hold every refresh for the full timeouts
+
+// circuitOpenError is returned without calling while the breaker is open
+type circuitOpenError struct {
+	until   time.Time
+	lastErr string
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("cluster is unreachable, calls paused until %s after: %s", e.until.Format(time.TimeOnly), e.lastErr)
+}
+
+// BreakerStatus is the state of a cluster's circuit breaker. closed lets
+// calls through, open fails them right away until the cooldown is over and
+// half-open lets a single call through to see whether the cluster is back
+type BreakerStatus struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"` // in a row
+	OpenedAt  *time.Time `json:"openedAt,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+type breaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	lastError string
+}
+
+func newBreaker() *breaker {
+	return &breaker{state: "closed"}
+}
+
+// allow reports whether a call may go out, an open breaker lets the first
+// call after the cooldown through as a probe. the call reports back with
+// probe so only the probe decides how a half-open breaker goes on
+func (b *breaker) allow(cooldown time.Duration) (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case "open":
+		if time.Since(b.openedAt) < cooldown {
+			return false, &circuitOpenError{until: b.openedAt.Add(cooldown), lastErr: b.lastError}
+		}
+		b.state = "half-open"
+		return true, nil
+	case "half-open":
+		// the probe is still out
+		return false, &circuitOpenError{until: time.Now().Add(cooldown), lastErr: b.lastError}
+	}
+	return false, nil
+}
+
+// record counts the outcome of a call. only failures that say the cluster is
+// in trouble count, a forbidden or not found is an answer like any other.
+// calls that went out before the breaker opened can come back any time
+// after, they change nothing but the failure count
+func (b *breaker) record(probe bool, err error, threshold int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || !retriable(err) {
+		switch {
+		case b.state == "closed":
+			b.failures = 0
+		case b.state == "half-open" && probe:
+			b.state = "closed"
+			b.failures = 0
+		}
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+	if threshold > 0 && ((b.state == "half-open" && probe) || (b.state == "closed" && b.failures >= threshold)) {
+		b.state = "open"
+		b.openedAt = time.Now()
+	}
+}
+
+// abandon is for a call the caller gave up on, which says nothing about the
+// cluster. an abandoned probe opens the breaker again so the next one goes
+// out after another cooldown, instead of waiting for an answer forever
+func (b *breaker) abandon(probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == "half-open" && probe {
+		b.state = "open"
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *breaker) status() *BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := &BreakerStatus{State: b.state, Failures: b.failures, LastError: b.lastError}
+	if b.state != "closed" {
+		at := b.openedAt
+		st.OpenedAt = &at
+	}
+	return st
+}
+
+// Breaker is the state of the cluster's circuit breaker
+func (cl *Cluster) Breaker() *BreakerStatus {
+	return cl.breaker.status()
+}
+
+// retriable reports whether err may go away on another try
+func retriable(err error) bool {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return false
+	case apierrors.IsTooManyRequests(err), apierrors.IsServerTimeout(err), apierrors.IsTimeout(err),
+		apierrors.IsInternalError(err), apierrors.IsServiceUnavailable(err), apierrors.IsUnexpectedServerError(err):
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	case utilnet.IsConnectionRefused(err), utilnet.IsConnectionReset(err), utilnet.IsProbableEOF(err):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return status.Status().Code >= 500
+	}
+	return false
+}
+
+// call runs fn against the cluster with the call timeout, retrying with
+// jittered backoff while the error is retriable and ctx has time left
+func (cl *Cluster) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	c := cl.collection()
+	probe, err := cl.breaker.allow(c.BreakerCooldown.D())
+	if err != nil {
+		return err
+	}
+
+	wait := c.RetryBackoff.D()
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := cl.callContext(ctx)
+		err := fn(callCtx)
+		cancel()
+
+		if ctx.Err() != nil {
+			cl.breaker.abandon(probe)
+			return err
+		}
+		if err == nil || !retriable(err) || attempt >= c.Retries {
+			cl.breaker.record(probe, err, c.BreakerThreshold)
+			return err
+		}
+
+		// equal jitter, half the backoff plus up to the other half, so
+		// clients that failed together dont retry together
+		delay := wait/2 + rand.N(wait/2+1)
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+			delay = max(delay, time.Duration(seconds)*time.Second)
+		}
+		select {
+		case <-ctx.Done():
+			cl.breaker.abandon(probe)
+			return err
+		case <-time.After(delay):
+		}
+		wait = min(wait*2, c.RetryMaxBackoff.D())
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestBreaker(t *testing.T) {
+	down := apierrors.NewServiceUnavailable("down")
+	const threshold = 2
+
+	b := newBreaker()
+	allow := func(cooldown time.Duration) bool {
+		t.Helper()
+		probe, err := b.allow(cooldown)
+		if err != nil {
+			t.Fatalf("call not allowed in state %s: %v", b.state, err)
+		}
+		return probe
+	}
+	wantState := func(state string) {
+		t.Helper()
+		if b.state != state {
+			t.Fatalf("state %s, want %s", b.state, state)
+		}
+	}
+
+	// a call goes out, then two others fail and open the breaker
+	early := allow(time.Hour)
+	for range threshold {
+		b.record(allow(time.Hour), down, threshold)
+	}
+	wantState("open")
+
+	// the early call comes back fine, which says nothing about now
+	b.record(early, nil, threshold)
+	wantState("open")
+	if _, err := b.allow(time.Hour); err == nil {
+		t.Fatal("open breaker let a call through before the cooldown")
+	}
+
+	// after the cooldown one probe goes out, the others wait for it
+	b.openedAt = time.Now().Add(-time.Minute)
+	probe := allow(time.Second)
+	if !probe {
+		t.Fatal("first call after the cooldown is no probe")
+	}
+	wantState("half-open")
+	if _, err := b.allow(time.Second); err == nil {
+		t.Fatal("half-open breaker let a second call through")
+	}
+
+	// a late call that is not the probe neither closes nor opens it
+	b.record(false, nil, threshold)
+	wantState("half-open")
+	b.record(false, down, threshold)
+	wantState("half-open")
+	b.abandon(false)
+	wantState("half-open")
+
+	// the probe failing opens it again, the next one succeeding closes it
+	b.record(probe, down, threshold)
+	wantState("open")
+	b.openedAt = time.Now().Add(-time.Minute)
+	probe = allow(time.Second)
+	b.record(probe, nil, threshold)
+	wantState("closed")
+	if b.failures != 0 {
+		t.Errorf("%d failures after closing, want 0", b.failures)
+	}
+
+	// an abandoned probe opens it again for another cooldown
+	for range threshold {
+		b.record(allow(time.Hour), down, threshold)
+	}
+	b.openedAt = time.Now().Add(-time.Minute)
+	b.abandon(allow(time.Second))
+	wantState("open")
+	if _, err := b.allow(time.Second); err == nil {
+		t.Error("abandoned probe let the next call through without a cooldown")
+	}
+}
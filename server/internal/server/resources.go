@@ -0,0 +1,157 @@
+package server
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// Resources are cpu in millicores and memory and ephemeral storage in bytes.
+// 0 is also what a container that sets nothing gets
+type Resources struct {
+	CPU              int64 `json:"cpu"`
+	Memory           int64 `json:"memory"`
+	EphemeralStorage int64 `json:"ephemeralstorage"`
+}
+
+// Percentages are shares of a node's allocatable, above 100 means it is
+// overcommitted
+type Percentages struct {
+	CPU              float64 `json:"cpu"`
+	Memory           float64 `json:"memory"`
+	EphemeralStorage float64 `json:"ephemeralstorage"`
+}
+
+// NamespaceResources add up the pods of a namespace that have not finished.
+// the without counts are containers setting neither a cpu nor a memory
+// request, or limit
+type NamespaceResources struct {
+	Requests        Resources `json:"requests"`
+	Limits          Resources `json:"limits"`
+	Containers      int       `json:"containers"`
+	WithoutRequests int       `json:"withoutrequests"`
+	WithoutLimits   int       `json:"withoutlimits"`
+}
+
+// NodeAllocation is what the pods scheduled on a node ask for, counted from
+// the pods the overview covers, so with namespace level access it is a
+// lower bound
+type NodeAllocation struct {
+	Pods     int         `json:"pods"`
+	Requests Resources   `json:"requests"`
+	Limits   Resources   `json:"limits"`
+	Percent  Allocations `json:"percent"`
+	// limits add up to more than the node has, it is fine until the pods
+	// actually use them
+	Overcommitted bool `json:"overcommitted"`
+}
+
+type Allocations struct {
+	Requests Percentages `json:"requests"`
+	Limits   Percentages `json:"limits"`
+}
+
+func resources(list v1.ResourceList) Resources {
+	return Resources{
+		CPU:              list.Cpu().MilliValue(),
+		Memory:           list.Memory().Value(),
+		EphemeralStorage: list.StorageEphemeral().Value(),
+	}
+}
+
+func (r Resources) add(o Resources) Resources {
+	return Resources{CPU: r.CPU + o.CPU, Memory: r.Memory + o.Memory, EphemeralStorage: r.EphemeralStorage + o.EphemeralStorage}
+}
+
+func (r Resources) max(o Resources) Resources {
+	return Resources{CPU: max(r.CPU, o.CPU), Memory: max(r.Memory, o.Memory), EphemeralStorage: max(r.EphemeralStorage, o.EphemeralStorage)}
+}
+
+func (r Resources) percentOf(total Resources) Percentages {
+	pct := func(n, of int64) float64 {
+		if of == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(of)
+	}
+	return Percentages{CPU: pct(r.CPU, total.CPU), Memory: pct(r.Memory, total.Memory), EphemeralStorage: pct(r.EphemeralStorage, total.EphemeralStorage)}
+}
+
+// podResources are what the scheduler reserves for a pod: its containers
+// and sidecars together, or the biggest init container if that is more,
+// plus the runtime overhead
+func podResources(pod *v1.Pod) (requests, limits Resources) {
+	for _, c := range pod.Spec.Containers {
+		requests = requests.add(resources(c.Resources.Requests))
+		limits = limits.add(resources(c.Resources.Limits))
+	}
+
+	// sidecars keep running, so they add up with what starts after them
+	var sidecarRequests, sidecarLimits, initRequests, initLimits Resources
+	for _, c := range pod.Spec.InitContainers {
+		if c.RestartPolicy != nil && *c.RestartPolicy == v1.ContainerRestartPolicyAlways {
+			sidecarRequests = sidecarRequests.add(resources(c.Resources.Requests))
+			sidecarLimits = sidecarLimits.add(resources(c.Resources.Limits))
+			continue
+		}
+		initRequests = initRequests.max(sidecarRequests.add(resources(c.Resources.Requests)))
+		initLimits = initLimits.max(sidecarLimits.add(resources(c.Resources.Limits)))
+	}
+	requests = requests.add(sidecarRequests).max(initRequests)
+	limits = limits.add(sidecarLimits).max(initLimits)
+
+	if pod.Spec.Overhead != nil {
+		requests = requests.add(resources(pod.Spec.Overhead))
+		limits = limits.add(resources(pod.Spec.Overhead))
+	}
+	return requests, limits
+}
+
+// finished pods hold on to nothing on their node
+func podFinished(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
+
+// withAllocation is ov with the allocation of every node worked out from
+// the pods. nodes and pods are refreshed apart, so it is done again for each
+// snapshot, on copies of the nodes
+func (ov *Overview) withAllocation() *Overview {
+	if ov.Nodes == nil {
+		return ov
+	}
+
+	byNode := make(map[string]*NodeAllocation)
+	if ov.Pods != nil {
+		for _, p := range ov.Pods.PodsList {
+			if p.Node == "" || p.Phase == string(v1.PodSucceeded) || p.Phase == string(v1.PodFailed) {
+				continue
+			}
+			a := byNode[p.Node]
+			if a == nil {
+				a = &NodeAllocation{}
+				byNode[p.Node] = a
+			}
+			a.Pods++
+			a.Requests = a.Requests.add(p.Requests)
+			a.Limits = a.Limits.add(p.Limits)
+		}
+	}
+
+	next := *ov
+	nodes := *ov.Nodes
+	nodes.Nodes = make([]*Nodesinfo, len(ov.Nodes.Nodes))
+	for i, n := range ov.Nodes.Nodes {
+		node := *n
+		node.Allocation = nil
+		if ov.Pods != nil {
+			a := byNode[n.Name]
+			if a == nil {
+				a = &NodeAllocation{}
+			}
+			a.Percent = Allocations{Requests: a.Requests.percentOf(n.Allocatable), Limits: a.Limits.percentOf(n.Allocatable)}
+			a.Overcommitted = a.Percent.Limits.CPU > 100 || a.Percent.Limits.Memory > 100
+			node.Allocation = a
+		}
+		nodes.Nodes[i] = &node
+	}
+	next.Nodes = &nodes
+	return &next
+}
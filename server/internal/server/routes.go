@@ -0,0 +1,335 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+const apiPrefix = "/api/v1"
+
+// Param is a query parameter a route accepts, path parameters come from the
+// {name} segments of the path itself
+type Param struct {
+	Name        string
+	Description string
+	Type        string // string, integer or boolean
+	Required    bool
+}
+
+// Route is one /api/v1 endpoint. the same table registers the handlers and
+// generates the openapi document, so adding a route here is all it takes
+type Route struct {
+	Method      string
+	Path        string // relative to /api/v1
+	Summary     string
+	Query       []Param
+	Request     interface{} // zero value of the body type, nil if none
+	ContentType string      // request content type, defaults to application/json
+	Status      int         // success status, defaults to 200
+	Response    interface{} // zero value of the response type
+	Stream      bool        // response is streamed text/plain instead of json
+	Feature     string      // toggle in config.Features that gates the route
+	Handler     http.HandlerFunc
+}
+
+// clusterParam is taken by every route that reads from one cluster
+var clusterParam = Param{Name: "cluster", Description: "registered cluster name, the current one when empty", Type: "string"}
+
+func (s *Server) APIRoutes() []Route {
+	return []Route{
+		{
+			Method:   http.MethodGet,
+			Path:     "/overview",
+			Summary:  "Cluster wide counts",
+			Query:    []Param{clusterParam},
+			Response: OverviewResponse{},
+			Handler:  s.apiOverview,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/pods",
+			Summary:  "All pods with per namespace counts",
+			Query:    []Param{clusterParam},
+			Response: PodsResponse{},
+			Handler:  s.apiPods,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/pods/{namespace}/{name}/restart",
+			Summary:  "Restart a pod by deleting it",
+			Query:    []Param{clusterParam},
+			Response: MessageResponse{},
+			Feature:  "restartPods",
+			Handler:  s.apiRestartPod,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/pods/{namespace}/{name}/logs",
+			Summary: "Pod logs, streamed as plain text",
+			Query: []Param{
+				{Name: "container", Description: "container name, needed when the pod has several", Type: "string"},
+				{Name: "follow", Description: "keep streaming new lines", Type: "boolean"},
+				{Name: "tail", Description: "only the last n lines", Type: "integer"},
+				clusterParam,
+			},
+			Stream:  true,
+			Feature: "logs",
+			Handler: s.apiPodLogs,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/nodes",
+			Summary:  "All nodes",
+			Query:    []Param{clusterParam},
+			Response: NodesResponse{},
+			Handler:  s.apiNodes,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/nodes/{name}/pods",
+			Summary:  "A node with the pods scheduled on it",
+			Query:    []Param{clusterParam},
+			Response: NodePodsResponse{},
+			Handler:  s.apiNodePods,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/services",
+			Summary:  "All services",
+			Query:    []Param{clusterParam},
+			Response: ServicesResponse{},
+			Handler:  s.apiServices,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/ingress",
+			Summary:  "All ingresses",
+			Query:    []Param{clusterParam},
+			Response: IngressResponse{},
+			Handler:  s.apiIngress,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/secrets",
+			Summary:  "Secret names and types, never the data",
+			Query:    []Param{clusterParam},
+			Response: SecretsResponse{},
+			Handler:  s.apiSecrets,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/configmaps",
+			Summary:  "All configmaps",
+			Query:    []Param{clusterParam},
+			Response: ConfigMapsResponse{},
+			Handler:  s.apiConfigMaps,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/search",
+			Summary: "Find objects by name, label, annotation, image, ip or host",
+			Query: []Param{
+				{Name: "q", Description: "free text query", Type: "string", Required: true},
+				{Name: "limit", Description: "max results, 0 for all", Type: "integer"},
+				clusterParam,
+			},
+			Response: SearchResponse{},
+			Feature:  "search",
+			Handler:  s.apiSearch,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/refresh",
+			Summary: "Reload the overview from the cluster",
+			Query: []Param{
+				clusterParam,
+				{Name: "maxAge", Description: "seconds, an overview loaded more recently is kept as is", Type: "integer"},
+				{Name: "kind", Description: "only these kinds, comma separated: namespaces, nodes, pods, services, ingress, secrets, configmaps", Type: "string"},
+				{Name: "namespace", Description: "only this namespace of the namespaced kinds", Type: "string"},
+			},
+			Response: RefreshResponse{},
+			Handler:  s.apiRefresh,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/whoami",
+			Summary:  "The user the request is authenticated as",
+			Response: Identity{},
+			Handler:  s.apiWhoAmI,
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/config",
+			Summary:     "Upload or paste a kubeconfig and register its cluster as the current one",
+			Request:     ConfigUpload{},
+			ContentType: "multipart/form-data",
+			Status:      http.StatusCreated,
+			Response:    KubeconfigResponse{},
+			Handler:     s.apiConfig,
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        "/config/validate",
+			Summary:     "Check a kubeconfig against the upload policy without connecting",
+			Request:     ConfigUpload{},
+			ContentType: "multipart/form-data",
+			Response:    ValidationReport{},
+			Handler:     s.apiValidateConfig,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/context",
+			Summary:  "Contexts in the kubeconfig and the one in use",
+			Query:    []Param{clusterParam},
+			Response: KubeconfigResponse{},
+			Handler:  s.apiContext,
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/context",
+			Summary:  "Switch to another context of the kubeconfig without uploading it again",
+			Query:    []Param{clusterParam},
+			Request:  ContextSwitch{},
+			Response: KubeconfigResponse{},
+			Handler:  s.apiSwitchContext,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/clusters",
+			Summary:  "Registered clusters",
+			Response: ClustersResponse{},
+			Handler:  s.apiClusters,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/clusters",
+			Summary:  "Register another context of a kubeconfig the server already has",
+			Request:  ClusterRegistration{},
+			Status:   http.StatusCreated,
+			Response: ClusterInfo{},
+			Handler:  s.apiRegisterCluster,
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/clusters/{name}",
+			Summary:  "Disconnect a registered cluster and forget its saved copy",
+			Response: MessageResponse{},
+			Handler:  s.apiRemoveCluster,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/stored-clusters",
+			Summary:  "Clusters saved to disk for the next start",
+			Response: StoredClustersResponse{},
+			Handler:  s.apiStoredClusters,
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/stored-clusters/{name}",
+			Summary:  "Forget the saved copy of a cluster, it stays connected until restart",
+			Response: MessageResponse{},
+			Handler:  s.apiForgetStoredCluster,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/fleet",
+			Summary: "Node and pod counts for every registered cluster",
+			Query: []Param{
+				{Name: "selector", Description: "only clusters with these labels, e.g. env=prod,team=infra", Type: "string"},
+			},
+			Response: FleetResponse{},
+			Handler:  s.apiFleet,
+		},
+	}
+}
+
+// Routes builds the mux with the legacy routes and the /api/v1 surface, all
+// under the configured route prefix
+func (s *Server) Routes() http.Handler {
+	prefix := s.Config().RoutePrefix
+	mux := http.NewServeMux()
+
+	// legacy routes the ui talks to
+	mux.HandleFunc(prefix+"/config", s.ConfigHandler)
+	mux.HandleFunc(prefix+"/overview", s.OverviewHandler)
+	mux.HandleFunc(prefix+"/pods", s.PodsHandler)
+	mux.HandleFunc(prefix+"/nodes", s.NodesHandler)
+	mux.HandleFunc(prefix+"/refresh", s.RefreshHandler)
+	mux.HandleFunc(prefix+"/svc", s.SVCHandler)
+	mux.HandleFunc(prefix+"/configmap", s.ConfigMapHandler)
+	mux.HandleFunc(prefix+"/restartpod", s.RestartPodHandler)
+	mux.HandleFunc(prefix+"/secrets", s.SecretsHandler)
+	mux.HandleFunc(prefix+"/ingress", s.IngressHandler)
+	mux.HandleFunc(prefix+"/search", s.SearchHandler)
+
+	// probes answer at the root for kubelet and under the prefix for anyone
+	// coming in through the ingress
+	for _, p := range probePrefixes(prefix) {
+		mux.HandleFunc("GET "+p+"/healthz", s.HealthzHandler)
+		mux.HandleFunc("GET "+p+"/readyz", s.ReadyzHandler)
+		mux.HandleFunc("GET "+p+"/version", s.VersionHandler)
+	}
+
+	// routes sharing a path are dispatched on method by one handler so
+	// preflight requests and 405s are answered consistently
+	byPath := make(map[string][]Route)
+	var paths []string
+	for _, rt := range s.APIRoutes() {
+		if _, ok := byPath[rt.Path]; !ok {
+			paths = append(paths, rt.Path)
+		}
+		byPath[rt.Path] = append(byPath[rt.Path], rt)
+	}
+	for _, p := range paths {
+		mux.Handle(prefix+apiPrefix+p, s.apiEndpoint(byPath[p]))
+	}
+
+	spec := s.OpenAPI(prefix)
+	mux.Handle(prefix+apiPrefix+"/openapi.json", s.apiEndpoint([]Route{{
+		Method: http.MethodGet,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, spec)
+		},
+	}}))
+
+	// anything else under /api/v1 gets a json 404 instead of the plain one
+	mux.HandleFunc(prefix+apiPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		s.EnableCors(w, r, r.Header.Get("Origin"))
+		writeError(w, http.StatusNotFound, "no route for %s", r.URL.Path)
+	})
+
+	return s.identify(mux)
+}
+
+func (s *Server) apiEndpoint(routes []Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.EnableCors(w, r, r.Header.Get("Origin"))
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		allowed := make([]string, 0, len(routes))
+		for _, rt := range routes {
+			if rt.Method == r.Method {
+				// checked per request so toggles follow config reloads
+				if !s.featureEnabled(rt.Feature) {
+					writeError(w, http.StatusNotFound, "%s is disabled on this server", rt.Feature)
+					return
+				}
+				rt.Handler(w, r)
+				return
+			}
+			allowed = append(allowed, rt.Method)
+		}
+
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	})
+}
+
+func probePrefixes(prefix string) []string {
+	if prefix == "" {
+		return []string{""}
+	}
+	return []string{"", prefix}
+}
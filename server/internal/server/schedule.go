@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"server/internal/config"
+)
+
+// kinds falling due this close together are refreshed at once
+const dueSlack = time.Second
+
+// dueKinds claims the kinds of cl that are due for a background refresh at
+// now and returns them, with when the next kind falls due after that. zero
+// when none is scheduled
+func (cl *Cluster) dueKinds(now time.Time, cfg *config.Config) ([]string, time.Time) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.attempted == nil {
+		cl.attempted = make(map[string]time.Time)
+	}
+
+	var due []string
+	var next time.Time
+	for _, kind := range config.Kinds {
+		interval := cfg.RefreshInterval.D()
+		if d, ok := cfg.RefreshIntervals[kind]; ok {
+			interval = d.D()
+		}
+		if interval <= 0 {
+			continue
+		}
+
+		last := cl.attempted[kind]
+		at := last.Add(interval + jitter(cl.Name, last, interval, cfg.RefreshJitter))
+		if !at.After(now.Add(dueSlack)) {
+			due = append(due, kind)
+			cl.attempted[kind] = now
+			at = now.Add(interval + jitter(cl.Name, now, interval, cfg.RefreshJitter))
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return due, next
+}
+
+// jitter moves a refresh by up to share of interval either way. it is worked
+// out from the cluster and the last attempt instead of drawn, so it holds
+// still between wakeups and kinds refreshed together stay together
+func jitter(name string, last time.Time, interval time.Duration, share float64) time.Duration {
+	if share == 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%d/%d", name, last.UnixNano(), interval)
+	f := float64(h.Sum64())/math.MaxUint64*2 - 1
+	return time.Duration(f * share * float64(interval))
+}
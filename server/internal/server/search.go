@@ -0,0 +1,221 @@
+package server
+
+import (
+	"sort"
+	"strings"
+)
+
+// how much a hit on each field is worth, an exact match on a name or ip
+// should always beat a label that happens to contain the same text
+const (
+	weightName       = 10
+	weightIP         = 10
+	weightHost       = 10
+	weightImage      = 6
+	weightLabel      = 4
+	weightAnnotation = 2
+)
+
+type SearchResult struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Field     string `json:"field"` // name, ip, host, image, label, annotation
+	Match     string `json:"match"` // the value that matched
+	Score     int    `json:"score"`
+}
+
+// searchHit keeps the best scoring field for one object
+type searchHit struct {
+	terms []string
+	field string
+	match string
+	score int
+	seen  []bool
+}
+
+func newSearchHit(terms []string) *searchHit {
+	return &searchHit{terms: terms, seen: make([]bool, len(terms))}
+}
+
+// check scores value against every term, exact > prefix > substring
+func (h *searchHit) check(field, value string, weight int) {
+	if value == "" {
+		return
+	}
+	v := strings.ToLower(value)
+
+	for i, t := range h.terms {
+		closeness := 0
+		switch {
+		case v == t:
+			closeness = 3
+		case strings.HasPrefix(v, t):
+			closeness = 2
+		case strings.Contains(v, t):
+			closeness = 1
+		}
+		if closeness == 0 {
+			continue
+		}
+
+		h.seen[i] = true
+		score := weight * closeness
+		if score > h.score {
+			h.score = score
+			h.field = field
+			h.match = value
+		}
+	}
+}
+
+func (h *searchHit) checkMap(field string, m map[string]string, weight int) {
+	for k, v := range m {
+		h.check(field, k+"="+v, weight)
+		h.check(field, k, weight)
+		h.check(field, v, weight)
+	}
+}
+
+// result is nil unless every term matched something on the object
+func (h *searchHit) result(kind, name, namespace string) *SearchResult {
+	for _, ok := range h.seen {
+		if !ok {
+			return nil
+		}
+	}
+
+	return &SearchResult{
+		Kind:      kind,
+		Name:      name,
+		Namespace: namespace,
+		Field:     h.field,
+		Match:     h.match,
+		Score:     h.score,
+	}
+}
+
+// Search looks through everything in the overview for q and returns the
+// matches ranked by relevance. every whitespace separated term in q has to
+// match the object somewhere. total is how many matched before the limit
+// cut them off
+func (ov *Overview) Search(q string, limit int) (results []*SearchResult, total int) {
+	terms := strings.Fields(strings.ToLower(q))
+	results = make([]*SearchResult, 0)
+	if len(terms) == 0 {
+		return results, 0
+	}
+
+	add := func(r *SearchResult) {
+		if r != nil {
+			results = append(results, r)
+		}
+	}
+
+	if ov.Pods != nil {
+		for _, p := range ov.Pods.PodsList {
+			h := newSearchHit(terms)
+			h.check("name", p.Name, weightName)
+			h.check("ip", p.IP, weightIP)
+			h.check("node", p.Node, weightLabel)
+			for _, c := range p.Containers {
+				h.check("image", c.Image, weightImage)
+			}
+			h.checkMap("label", p.Labels, weightLabel)
+			h.checkMap("annotation", p.Annotations, weightAnnotation)
+			add(h.result("pod", p.Name, p.NameSpace))
+		}
+	}
+
+	if ov.Services != nil {
+		for _, svc := range ov.Services.ServiceList {
+			h := newSearchHit(terms)
+			h.check("name", svc.Name, weightName)
+			for _, ip := range svc.ClusterIP {
+				h.check("ip", ip, weightIP)
+			}
+			for _, ip := range svc.ExternalIP {
+				h.check("ip", ip, weightIP)
+			}
+			h.checkMap("label", svc.Labels, weightLabel)
+			h.checkMap("selector", svc.Selector, weightLabel)
+			h.checkMap("annotation", svc.Annotations, weightAnnotation)
+			add(h.result("service", svc.Name, svc.Namespace))
+		}
+	}
+
+	if ov.Ingress != nil {
+		for _, ing := range ov.Ingress.IngressList {
+			h := newSearchHit(terms)
+			h.check("name", ing.Name, weightName)
+			h.check("ip", ing.Address, weightIP)
+			for _, host := range ing.Hosts {
+				h.check("host", host, weightHost)
+			}
+			h.checkMap("label", ing.Labels, weightLabel)
+			h.checkMap("annotation", ing.Annotations, weightAnnotation)
+			add(h.result("ingress", ing.Name, ing.Namespace))
+		}
+	}
+
+	// secrets only ever match on their name
+	if ov.Secrets != nil {
+		for _, sec := range ov.Secrets.Secrets {
+			h := newSearchHit(terms)
+			h.check("name", sec.Name, weightName)
+			add(h.result("secret", sec.Name, sec.NameSpace))
+		}
+	}
+
+	if ov.ConfigMaps != nil {
+		for _, m := range ov.ConfigMaps.Confs {
+			h := newSearchHit(terms)
+			h.check("name", m.Name, weightName)
+			h.checkMap("label", m.Labels, weightLabel)
+			h.checkMap("annotation", m.Annotations, weightAnnotation)
+			add(h.result("configmap", m.Name, m.NameSpace))
+		}
+	}
+
+	if ov.Nodes != nil {
+		for _, n := range ov.Nodes.Nodes {
+			h := newSearchHit(terms)
+			h.check("name", n.Name, weightName)
+			h.check("ip", n.InternalIP, weightIP)
+			h.checkMap("label", n.Labels, weightLabel)
+			h.checkMap("annotation", n.Annotations, weightAnnotation)
+			add(h.result("node", n.Name, ""))
+		}
+	}
+
+	if ov.NameSpace != nil && ov.NameSpace.NameSpaces != nil {
+		for _, ns := range ov.NameSpace.NameSpaces.Items {
+			h := newSearchHit(terms)
+			h.check("name", ns.Name, weightName)
+			h.checkMap("label", ns.Labels, weightLabel)
+			h.checkMap("annotation", ns.Annotations, weightAnnotation)
+			add(h.result("namespace", ns.Name, ""))
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	total = len(results)
+	if limit > 0 && total > limit {
+		results = results[:limit]
+	}
+
+	return results, total
+}
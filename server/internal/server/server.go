@@ -1,20 +1,38 @@
 package server
 
 import (
+	"context"
 	"crypto/rand"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"server/internal/config"
+	"server/internal/store"
 )
 
 type Server struct {
 	SessionKey []byte
-	Overview   *Overview
-	RestConfig *rest.Config
-	ClientSet  *kubernetes.Clientset
+
+	cfg atomic.Pointer[config.Config]
+	// wakes the refresh loop to look at the settings and clusters again
+	reschedule chan struct{}
+
+	// cancelled on shutdown so followed log streams end instead of holding
+	// the drain open until the timeout
+	streams     context.Context
+	stopStreams context.CancelFunc
+
+	mu       sync.Mutex
+	clusters map[string]*Cluster
+	current  string // cluster used when a request names none
+
+	// saved clusters, nil when no master secret is configured
+	store *store.Store
 }
 
-func CreateNewServer() *Server {
+func CreateNewServer(cfg *config.Config) *Server {
 	sessionKey := createSessionKey()
 
 	// Store := sessions.NewCookieStore(sessionKey)
@@ -28,7 +46,14 @@ func CreateNewServer() *Server {
 	// c := make(map[string]*rest.Config)
 	// o := make(map[string]*Overview)
 
-	return &Server{SessionKey: sessionKey}
+	s := &Server{
+		SessionKey: sessionKey,
+		reschedule: make(chan struct{}, 1),
+		clusters:   make(map[string]*Cluster),
+	}
+	s.streams, s.stopStreams = context.WithCancel(context.Background())
+	s.cfg.Store(cfg)
+	return s
 
 }
 
@@ -38,3 +63,106 @@ func createSessionKey() []byte {
 	return key
 
 }
+
+// StopStreams ends every open log stream, meant for http.Server.RegisterOnShutdown
+func (s *Server) StopStreams() {
+	s.stopStreams()
+}
+
+// Close is called once the http server has drained and the background work
+// has stopped. saved clusters are written as they change, so there is
+// nothing left to flush
+func (s *Server) Close() error {
+	s.stopStreams()
+	return nil
+}
+
+func (s *Server) Config() *config.Config {
+	return s.cfg.Load()
+}
+
+// ApplyConfig switches to next for everything that can change while running
+// and returns the settings that only take effect after a restart
+func (s *Server) ApplyConfig(next *config.Config) []string {
+	prev := s.Config()
+	s.cfg.Store(prev.Live(next))
+
+	s.wakeRefreshLoop()
+	return prev.RestartRequired(next)
+}
+
+func (s *Server) wakeRefreshLoop() {
+	select {
+	case s.reschedule <- struct{}{}:
+	default:
+	}
+}
+
+// RunRefreshLoop refreshes the clusters in the background until ctx is done.
+// every kind falls due its interval after it was last refreshed, moved by
+// the jitter, and the kinds due together go in one refresh. the intervals
+// are read again on every wakeup and after a reload
+func (s *Server) RunRefreshLoop(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		cfg := s.Config()
+		now := time.Now()
+		// clusters registered meanwhile are looked at within a minute
+		wake := now.Add(time.Minute)
+		for _, cl := range s.Clusters() {
+			kinds, next := cl.dueKinds(now, cfg)
+			if len(kinds) > 0 {
+				// one slow cluster does not hold the others back
+				wg.Go(func() {
+					if err := cl.RefreshPart(ctx, RefreshTarget{Kinds: kinds}); err != nil && ctx.Err() == nil {
+						log.Printf("background refresh of %s: %v", cl.Name, err)
+					}
+				})
+			}
+			if !next.IsZero() && next.Before(wake) {
+				wake = next
+			}
+		}
+
+		t := time.NewTimer(time.Until(wake))
+		select {
+		case <-ctx.Done():
+		case <-s.reschedule:
+		case <-t.C:
+		}
+		t.Stop()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) originAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, o := range s.Config().CORSOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// featureEnabled looks a toggle up by the name used in the config file
+func (s *Server) featureEnabled(name string) bool {
+	f := s.Config().Features
+	switch name {
+	case "":
+		return true
+	case "search":
+		return f.Search
+	case "logs":
+		return f.Logs
+	case "restartPods":
+		return f.RestartPods
+	}
+	return false
+}
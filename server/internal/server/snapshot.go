@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"server/internal/config"
+)
+
+// Snapshot is one collected overview of a cluster. it is never changed once
+// stored, a refresh swaps in a new one and handlers that need to adjust a
+// part of it copy that part first
+type Snapshot struct {
+	// counts up from 1 with every overview the cluster stores
+	Generation uint64
+	At         time.Time
+	Overview   *Overview
+}
+
+// refreshCall is a collection in flight, refreshes asked for while it runs
+// wait for it instead of starting their own
+type refreshCall struct {
+	key     string
+	target  RefreshTarget
+	done    chan struct{}
+	status  *RefreshStatus
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Snapshot is the current snapshot, nil until the first refresh worked. take
+// it once per request so every part read comes from the same collection
+func (cl *Cluster) Snapshot() *Snapshot {
+	return cl.snapshot.Load()
+}
+
+// Overview is the overview of the current snapshot
+func (cl *Cluster) Overview() *Overview {
+	if snap := cl.Snapshot(); snap != nil {
+		return snap.Overview
+	}
+	return nil
+}
+
+// Refresh reloads the overview from the cluster and remembers the outcome.
+// a partial overview is no error, the failed parts keep what loaded before
+// and their collectors say they failed. concurrent refreshes share one collection, which
+// stops once every caller waiting on it has gone away
+func (cl *Cluster) Refresh(ctx context.Context) error {
+	return cl.RefreshPart(ctx, RefreshTarget{})
+}
+
+// RefreshTarget narrows a refresh down to some kinds, see config.Kinds,
+// and to one namespace of them. the zero value refreshes everything
+type RefreshTarget struct {
+	Kinds     []string
+	Namespace string
+}
+
+// RefreshPart reloads only the target and merges it into the current
+// snapshot. no kinds or all of them is a full refresh, and so is the first
+// one. a running refresh of the same target or of everything is joined
+func (cl *Cluster) RefreshPart(ctx context.Context, target RefreshTarget) error {
+	_, err := cl.refresh(ctx, target)
+	return err
+}
+
+// refresh is RefreshPart, with how the collection it ran or joined went
+func (cl *Cluster) refresh(ctx context.Context, target RefreshTarget) (*RefreshStatus, error) {
+	target.Kinds = normalizeKinds(target.Kinds)
+	key := strings.Join(target.Kinds, ",")
+	if target.Namespace != "" {
+		key = target.Namespace + "/" + key
+	}
+
+	cl.mu.Lock()
+	call := cl.refreshing[""]
+	if call == nil {
+		call = cl.refreshing[key]
+	}
+	if call == nil {
+		collectCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &refreshCall{key: key, target: target, done: make(chan struct{}), cancel: cancel}
+		if cl.refreshing == nil {
+			cl.refreshing = make(map[string]*refreshCall)
+		}
+		cl.refreshing[key] = call
+		// the schedule counts from the attempt, a kind that fails to load
+		// waits out its interval like one that loaded. one namespace does
+		// not make a kind fresh
+		if cl.attempted == nil {
+			cl.attempted = make(map[string]time.Time)
+		}
+		if target.Namespace == "" {
+			now := time.Now()
+			for _, kind := range orAll(target.Kinds) {
+				cl.attempted[kind] = now
+			}
+		}
+		go cl.collect(collectCtx, call)
+	}
+	call.waiters++
+	cl.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.status, call.err
+	case <-ctx.Done():
+		cl.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// callers from now on start over instead of joining a
+			// collection that is stopping
+			call.cancel()
+			cl.forget(call)
+		}
+		cl.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// RefreshIfOlder refreshes the target unless each of its kinds was loaded
+// within maxAge, and says how the refresh went, nil when it did not run.
+// with maxAge 0 it always refreshes
+func (cl *Cluster) RefreshIfOlder(ctx context.Context, target RefreshTarget, maxAge time.Duration) (*RefreshStatus, error) {
+	if maxAge > 0 && cl.fresh(target.Kinds, maxAge) {
+		return nil, nil
+	}
+	return cl.refresh(ctx, target)
+}
+
+// fresh is whether every one of kinds was loaded within maxAge. a kind that
+// failed counts too, asking again right away would not go better
+func (cl *Cluster) fresh(kinds []string, maxAge time.Duration) bool {
+	snap := cl.Snapshot()
+	if snap == nil {
+		return false
+	}
+	for _, kind := range orAll(normalizeKinds(kinds)) {
+		c := snap.Overview.Collector(kind)
+		if c == nil || time.Since(c.At) > maxAge {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeKinds sorts and dedupes kinds so equal requests share a key, all
+// kinds come back as nil
+func normalizeKinds(kinds []string) []string {
+	kinds = slices.Compact(slices.Sorted(slices.Values(kinds)))
+	for _, kind := range config.Kinds {
+		if !slices.Contains(kinds, kind) {
+			return kinds
+		}
+	}
+	return nil
+}
+
+// orAll is kinds, or every kind when there are none
+func orAll(kinds []string) []string {
+	if len(kinds) == 0 {
+		return config.Kinds
+	}
+	return kinds
+}
+
+// forget takes call out of the running refreshes, unless a newer one took
+// its key already. callers hold cl.mu
+func (cl *Cluster) forget(call *refreshCall) {
+	if cl.refreshing[call.key] == call {
+		delete(cl.refreshing, call.key)
+	}
+}
+
+func (cl *Cluster) collect(ctx context.Context, call *refreshCall) {
+	defer call.cancel()
+
+	// parts need a snapshot to be merged into
+	prev := cl.Snapshot()
+	kinds, ns := call.target.Kinds, call.target.Namespace
+	if prev == nil && ns == "" {
+		kinds = nil
+	}
+
+	start := time.Now()
+	var overview *Overview
+	var err error
+	if ns != "" {
+		overview, err = cl.getNamespaceOverview(ctx, kinds, ns, prev.overview())
+	} else {
+		overview, err = cl.getOverview(ctx, kinds, prev.overview())
+	}
+
+	status := &RefreshStatus{At: start, DurationMs: time.Since(start).Milliseconds(), Kinds: kinds, Namespace: ns}
+	if err != nil {
+		status.Error = err.Error()
+	} else if partial := overview.Err(); partial != nil {
+		status.Error = partial.Error()
+		status.Partial = true
+	}
+
+	// a collection everyone gave up on says nothing about the cluster, and
+	// what it got before stopping is no overview to keep
+	abandoned := ctx.Err() != nil
+	if abandoned && err == nil {
+		err = ctx.Err()
+	}
+
+	cl.mu.Lock()
+	cur := cl.snapshot.Load()
+	switch {
+	case abandoned:
+	case err == nil:
+		// merged into the latest snapshot, not prev, so parts another
+		// refresh stored meanwhile are kept, and so are the last good ones
+		// of the parts that failed this time
+		var gen uint64 = 1
+		if cur != nil {
+			gen = cur.Generation + 1
+			if ns != "" {
+				overview = cur.Overview.mergeNamespace(overview, ns)
+			} else {
+				overview = cur.Overview.merge(overview)
+			}
+		}
+		overview = overview.withAllocation().withServicePods()
+		cl.snapshot.Store(&Snapshot{Generation: gen, At: start, Overview: overview})
+		status.Generation = gen
+	case ns == "" && overview != nil && cur != nil:
+		// nothing loaded, the snapshot keeps its parts but says they failed
+		// to refresh. the cluster's status and readiness go by its collectors
+		gen := cur.Generation + 1
+		cl.snapshot.Store(&Snapshot{Generation: gen, At: cur.At, Overview: cur.Overview.merge(overview)})
+		status.Generation = gen
+	}
+	// one namespace says nothing about the cluster, only its caller gets
+	// to know how it went
+	if !abandoned && ns == "" {
+		cl.lastRefresh = status
+	}
+	cl.forget(call)
+	call.status, call.err = status, err
+	cl.mu.Unlock()
+
+	close(call.done)
+}
+
+func (snap *Snapshot) overview() *Overview {
+	if snap == nil {
+		return nil
+	}
+	return snap.Overview
+}
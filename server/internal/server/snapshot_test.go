@@ -0,0 +1,340 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"server/internal/config"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// these run many refreshes at once and are meant for go test -race
+
+// gatedCluster is a fake cluster whose pod lists wait for release, so
+// refreshes can be piled up on one collection. lists counts the pod lists
+func gatedCluster() (cl *Cluster, release func(), lists *atomic.Int32) {
+	objs := []runtime.Object{
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "web"}},
+		&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "web"}},
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "web"}},
+	}
+	cl, cs := fakeCluster(config.Default(), objs...)
+
+	gate := make(chan struct{})
+	lists = &atomic.Int32{}
+	cs.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		lists.Add(1)
+		<-gate
+		return false, nil, nil
+	})
+	return cl, sync.OnceFunc(func() { close(gate) }), lists
+}
+
+// waitForWaiters blocks until n callers wait on the refresh under key
+func waitForWaiters(t *testing.T, cl *Cluster, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		cl.mu.Lock()
+		call := cl.refreshing[key]
+		joined := call != nil && call.waiters == n
+		cl.mu.Unlock()
+		if joined {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d waiters never joined the refresh", n)
+}
+
+// running is the refresh under key
+func running(cl *Cluster, key string) *refreshCall {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.refreshing[key]
+}
+
+// waitDone blocks until call finished collecting
+func waitDone(t *testing.T, call *refreshCall) {
+	t.Helper()
+	select {
+	case <-call.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh never finished")
+	}
+}
+
+func TestRefreshCoalesces(t *testing.T) {
+	cl, release, lists := gatedCluster()
+	defer release()
+
+	// readers take snapshots the whole time, each one whole and never older
+	// than the one before
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for range 4 {
+		readers.Go(func() {
+			var last uint64
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				snap := cl.Snapshot()
+				if snap == nil {
+					continue
+				}
+				if snap.Overview == nil || snap.Generation < last {
+					t.Errorf("snapshot generation %d after %d", snap.Generation, last)
+					return
+				}
+				last = snap.Generation
+			}
+		})
+	}
+
+	const callers = 50
+	errs := make(chan error, callers)
+	go func() { errs <- cl.Refresh(context.Background()) }()
+	waitForWaiters(t, cl, "", 1)
+	for i := 1; i < callers; i++ {
+		go func() {
+			// a refresh of some kinds joins the full one in flight
+			target := RefreshTarget{}
+			if i%2 == 1 {
+				target.Kinds = []string{"pods"}
+			}
+			errs <- cl.RefreshPart(context.Background(), target)
+		}()
+	}
+	waitForWaiters(t, cl, "", callers)
+	release()
+
+	for range callers {
+		if err := <-errs; err != nil {
+			t.Errorf("refresh: %v", err)
+		}
+	}
+	if n := lists.Load(); n != 1 {
+		t.Errorf("pods listed %d times, want once", n)
+	}
+	if gen := cl.Snapshot().Generation; gen != 1 {
+		t.Errorf("generation %d, want 1", gen)
+	}
+
+	// partial refreshes of different kinds run side by side and each lands
+	// in its own generation
+	var wg sync.WaitGroup
+	for _, kinds := range [][]string{{"pods"}, {"services"}, {"nodes"}, {"pods", "services"}, {"configmaps"}} {
+		wg.Go(func() {
+			if err := cl.RefreshPart(context.Background(), RefreshTarget{Kinds: kinds}); err != nil {
+				t.Errorf("refresh %v: %v", kinds, err)
+			}
+		})
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	snap := cl.Snapshot()
+	if snap.Generation < 2 || snap.Generation > 6 {
+		t.Errorf("generation %d, want 2 to 6", snap.Generation)
+	}
+	if snap.Overview.Pods == nil || snap.Overview.Services == nil || snap.Overview.Nodes == nil {
+		t.Error("partial refreshes lost parts of the snapshot")
+	}
+}
+
+func TestRefreshWaitersCancel(t *testing.T) {
+	cl, release, _ := gatedCluster()
+	defer release()
+
+	// everyone gives up, the collection is abandoned and stores nothing
+	const callers = 10
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, callers)
+	for range callers {
+		go func() { errs <- cl.Refresh(ctx) }()
+	}
+	waitForWaiters(t, cl, "", callers)
+	call := running(cl, "")
+	cancel()
+	for range callers {
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("refresh = %v, want canceled", err)
+		}
+	}
+	release()
+	waitDone(t, call)
+
+	if cl.Snapshot() != nil {
+		t.Error("an abandoned refresh stored a snapshot")
+	}
+	if cl.LastRefresh() != nil {
+		t.Error("an abandoned refresh was recorded")
+	}
+
+	// some give up, the rest still get the collection
+	cl, release, _ = gatedCluster()
+	defer release()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	gone, stayed := make(chan error, callers), make(chan error, callers)
+	for i := range callers {
+		go func() {
+			if i%2 == 0 {
+				gone <- cl.Refresh(ctx)
+				return
+			}
+			stayed <- cl.Refresh(context.Background())
+		}()
+	}
+	waitForWaiters(t, cl, "", callers)
+	cancel()
+	for range callers / 2 {
+		if err := <-gone; !errors.Is(err, context.Canceled) {
+			t.Errorf("refresh = %v, want canceled", err)
+		}
+	}
+	release()
+	for range callers / 2 {
+		if err := <-stayed; err != nil {
+			t.Errorf("refresh: %v", err)
+		}
+	}
+	if snap := cl.Snapshot(); snap == nil || snap.Generation != 1 {
+		t.Errorf("snapshot %+v, want generation 1", snap)
+	}
+}
+
+func TestRefreshAfterCancel(t *testing.T) {
+	cl, release, lists := gatedCluster()
+	defer release()
+
+	// the last waiter gives up while the collection is still listing
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- cl.Refresh(ctx) }()
+	waitForWaiters(t, cl, "", 1)
+	stopped := running(cl, "")
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("refresh = %v, want canceled", err)
+	}
+
+	// a caller right after starts a collection of its own instead of
+	// joining the one that is stopping
+	go func() { errs <- cl.Refresh(context.Background()) }()
+	waitForWaiters(t, cl, "", 1)
+	if running(cl, "") == stopped {
+		t.Fatal("new caller joined the cancelled refresh")
+	}
+	release()
+	if err := <-errs; err != nil {
+		t.Errorf("refresh: %v", err)
+	}
+	waitDone(t, stopped)
+
+	if snap := cl.Snapshot(); snap == nil || snap.Generation != 1 {
+		t.Errorf("snapshot %+v, want generation 1", snap)
+	}
+	if n := lists.Load(); n != 2 {
+		t.Errorf("pods listed %d times, want twice", n)
+	}
+	if call := running(cl, ""); call != nil {
+		t.Error("the stopped refresh left a call behind")
+	}
+}
+
+func TestStatusFromSnapshot(t *testing.T) {
+	cl, release, _ := gatedCluster()
+	release()
+	if err := cl.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if fc := fleetCluster(cl); fc.Status != "ok" {
+		t.Fatalf("status %s after a full refresh, want ok", fc.Status)
+	}
+
+	// a refresh of nodes alone that fails keeps the nodes and says so
+	cs := cl.ClientSet.(*fake.Clientset)
+	cs.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("nodes are down")
+	})
+	if err := cl.RefreshPart(context.Background(), RefreshTarget{Kinds: []string{"nodes"}}); err == nil {
+		t.Fatal("failed nodes refresh returned no error")
+	}
+	fc := fleetCluster(cl)
+	if fc.Status != "degraded" || fc.Nodes == nil {
+		t.Errorf("status %s with nodes %v, want degraded with the nodes kept", fc.Status, fc.Nodes)
+	}
+	if c := cl.Overview().Collector("nodes"); c.Status != "error" {
+		t.Errorf("nodes collector %s, want error", c.Status)
+	}
+
+	// one namespace failing says nothing about the cluster
+	cs.PrependReactor("list", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("services are down")
+	})
+	last := cl.LastRefresh()
+	cl.RefreshPart(context.Background(), RefreshTarget{Kinds: []string{"services"}, Namespace: "web"})
+	if c := cl.Overview().Collector("services"); c.Status != "ok" {
+		t.Errorf("services collector %s after a namespace refresh, want ok", c.Status)
+	}
+	if cl.LastRefresh() != last {
+		t.Error("a namespace refresh was recorded as the cluster's last refresh")
+	}
+
+	// everything failing is an error
+	cs.PrependReactor("list", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("cluster is down")
+	})
+	cl.Refresh(context.Background())
+	if fc := fleetCluster(cl); fc.Status != "error" || fc.Pods == nil {
+		t.Errorf("status %s with pods %v, want error with the pods kept", fc.Status, fc.Pods)
+	}
+}
+
+func TestRefreshKeepsGoodParts(t *testing.T) {
+	cl, release, _ := gatedCluster()
+	release()
+	if err := cl.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a full refresh where services fail and the rest loads
+	cs := cl.ClientSet.(*fake.Clientset)
+	cs.PrependReactor("list", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("services are down")
+	})
+	if err := cl.Refresh(context.Background()); err != nil {
+		t.Fatalf("partial refresh: %v", err)
+	}
+
+	snap := cl.Snapshot()
+	if snap.Generation != 2 {
+		t.Errorf("generation %d, want 2", snap.Generation)
+	}
+	if svc := snap.Overview.Services; svc == nil || len(svc.ServiceList) != 1 {
+		t.Errorf("services %+v, want the one from the first refresh", svc)
+	}
+	if c := snap.Overview.Collector("services"); c.Status != "error" {
+		t.Errorf("services collector %s, want error", c.Status)
+	}
+	if c := snap.Overview.Collector("pods"); c.Status != "ok" || snap.Overview.Pods == nil {
+		t.Errorf("pods collector %s, want ok with the pods loaded", c.Status)
+	}
+}
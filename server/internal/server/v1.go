@@ -0,0 +1,405 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/config"
+)
+
+// handlers for the /api/v1 routes, method checks and cors are done by
+// apiEndpoint before these run
+
+// currentSnapshot is the snapshot of the cluster the request picked, 503
+// when it has not loaded one yet. the whole response is read from it, so a
+// refresh finishing halfway through does not mix two collections
+func (s *Server) currentSnapshot(w http.ResponseWriter, r *http.Request) (*Snapshot, bool) {
+	cl, ok := s.selectCluster(w, r)
+	if !ok {
+		return nil, false
+	}
+	snap := cl.Snapshot()
+	if snap == nil {
+		writeError(w, http.StatusServiceUnavailable, "cluster %s has no overview loaded yet", cl.Name)
+		return nil, false
+	}
+	return snap, true
+}
+
+func (s *Server) apiOverview(w http.ResponseWriter, r *http.Request) {
+	snap, ok := s.currentSnapshot(w, r)
+	if !ok {
+		return
+	}
+	ov := snap.Overview
+
+	res := &OverviewResponse{
+		Namespaces: ov.NameSpace,
+		Pods:       ov.Pods,
+		Services:   ov.Services,
+		Ingress:    ov.Ingress,
+		Secrets:    ov.Secrets,
+		ConfigMaps: ov.ConfigMaps,
+		Collectors: ov.Collectors,
+		Access:     ov.Access,
+		Generation: snap.Generation,
+	}
+	if ov.Nodes != nil {
+		res.Nodes = &NodeCounts{Total: ov.Nodes.TotalNodes, Running: ov.Nodes.RunningNodes}
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// writeMissing answers for a part of the overview its collector could not
+// load, with a status matching why
+func writeMissing(w http.ResponseWriter, ov *Overview, name string) {
+	c := ov.Collector(name)
+	if c == nil {
+		writeError(w, http.StatusServiceUnavailable, "%s are not loaded", name)
+		return
+	}
+
+	status := http.StatusBadGateway
+	switch c.Status {
+	case "forbidden":
+		status = http.StatusForbidden
+	case "timeout":
+		status = http.StatusGatewayTimeout
+	}
+	writeError(w, status, "%s did not load (%s): %s", name, c.Status, c.Message)
+}
+
+// namespaceList is what every list response carries for the ui filters
+func (ov *Overview) namespaceList() []string {
+	if ov.NameSpace == nil {
+		return nil
+	}
+	return ov.NameSpace.NameSpaceList
+}
+
+func (s *Server) apiPods(w http.ResponseWriter, r *http.Request) {
+	snap, ok := s.currentSnapshot(w, r)
+	if !ok {
+		return
+	}
+	ov := snap.Overview
+	if ov.Pods == nil {
+		writeMissing(w, ov, "pods")
+		return
+	}
+
+	pods := *ov.Pods
+	pods.NamespaceList = ov.namespaceList()
+	writeJSON(w, http.StatusOK, &PodsResponse{Pods: &pods, Generation: snap.Generation})
+}
+
+func (s *Server) apiNodes(w http.ResponseWriter, r *http.Request) {
+	snap, ok := s.currentSnapshot(w, r)
+	if !ok {
+		return
+	}
+	ov := snap.Overview
+	if ov.Nodes == nil {
+		writeMissing(w, ov, "nodes")
+		return
+	}
+	writeJSON(w, http.StatusOK, &NodesResponse{Nodes: ov.Nodes, Generation: snap.Generation})
+}
+
+func (s *Server) apiNodePods(w http.ResponseWriter, r *http.Request) {
+	snap, ok := s.currentSnapshot(w, r)
+	if !ok {
+		return
+	}
+	ov := snap.Overview
+	if ov.Nodes == nil {
+		writeMissing(w, ov, "nodes")
+		return
+	}
+	name := r.PathValue("name")
+	node := ov.Nodes.Node(name)
+	if node == nil {
+		writeError(w, http.StatusNotFound, "node %s not found", name)
+		return
+	}
+	if ov.Pods == nil {
+		writeMissing(w, ov, "pods")
+		return
+	}
+
+	pods := []*PodsInfo{}
+	for _, pod := range ov.Pods.PodsList {
+		if pod.Node == name {
+			pods = append(pods, pod)
+		}
+	}
+	writeJSON(w, http.StatusOK, &NodePodsResponse{Node: node, Pods: pods, Generation: snap.Generation})
+}
+
+func (s *Server) apiServices(w http.ResponseWriter, r *http.Request) {
+	snap, ok := s.currentSnapshot(w, r)
+	if !ok {
+		return
+	}
+	ov := snap.Overview
+	if ov.Services == nil {
+		writeMissing(w, ov, "services")
+		return
+	}
+
+	svc := *ov.Services
+	svc.NameSpaceList = ov.namespaceList()
+	writeJSON(w, http.StatusOK, &ServicesResponse{Services: &svc, Generation: snap.Generation})
+}
+
+func (s *Server) apiIngress(w http.ResponseWriter, r *http.Request) {
+	snap, ok := s.currentSnapshot(w, r)
+	if !ok {
+		return
+	}
+	ov := snap.Overview
+	if ov.Ingress == nil {
+		writeMissing(w, ov, "ingress")
+		return
+	}
+
+	ing := *ov.Ingress
+	ing.NameSpaceList = ov.namespaceList()
+	writeJSON(w, http.StatusOK, &IngressResponse{Ingress: &ing, Generation: snap.Generation})
+}
+
+func (s *Server) apiSecrets(w http.ResponseWriter, r *http.Request) {
+	snap, ok := s.currentSnapshot(w, r)
+	if !ok {
+		return
+	}
+	ov := snap.Overview
+	if ov.Secrets == nil {
+		writeMissing(w, ov, "secrets")
+		return
+	}
+
+	sec := *ov.Secrets
+	sec.NameSpaceList = ov.namespaceList()
+	writeJSON(w, http.StatusOK, &SecretsResponse{Secrets: &sec, Generation: snap.Generation})
+}
+
+func (s *Server) apiConfigMaps(w http.ResponseWriter, r *http.Request) {
+	snap, ok := s.currentSnapshot(w, r)
+	if !ok {
+		return
+	}
+	ov := snap.Overview
+	if ov.ConfigMaps == nil {
+		writeMissing(w, ov, "configmaps")
+		return
+	}
+
+	m := *ov.ConfigMaps
+	m.NameSpaceList = ov.namespaceList()
+	writeJSON(w, http.StatusOK, &ConfigMapsResponse{ConfigMaps: &m, Generation: snap.Generation})
+}
+
+func (s *Server) apiSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "missing search query q")
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit %q", l)
+			return
+		}
+		limit = n
+	}
+
+	snap, ok := s.currentSnapshot(w, r)
+	if !ok {
+		return
+	}
+	ov := snap.Overview
+
+	results, total := ov.Search(q, limit)
+	writeJSON(w, http.StatusOK, &SearchResponse{Query: q, Total: total, Results: results, Generation: snap.Generation})
+}
+
+func (s *Server) apiRefresh(w http.ResponseWriter, r *http.Request) {
+	cl, ok := s.selectCluster(w, r)
+	if !ok {
+		return
+	}
+
+	maxAge, err := maxAgeParam(r, 0)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	target, err := refreshTarget(r, cl)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	status, err := cl.RefreshIfOlder(r.Context(), target, maxAge)
+	if err != nil {
+		writeError(w, kubeStatus(err), "error refreshing overview: %s", err.Error())
+		return
+	}
+
+	res := &RefreshResponse{Message: "refreshed", Refreshed: status != nil}
+	if snap := cl.Snapshot(); snap != nil {
+		res.Generation = snap.Generation
+	}
+	if status == nil {
+		res.Message = "fresh enough, not refreshed"
+	} else if status.Partial {
+		res.Message = "partly refreshed, " + status.Error
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// refreshTarget reads the kind and namespace query parameters. kind can be
+// repeated or comma separated, a namespace has to be one the overview of cl
+// covers
+func refreshTarget(r *http.Request, cl *Cluster) (RefreshTarget, error) {
+	var target RefreshTarget
+	for _, v := range r.URL.Query()["kind"] {
+		for _, kind := range splitNames(v) {
+			if !slices.Contains(config.Kinds, kind) {
+				return target, newHTTPError(http.StatusBadRequest, "unknown kind %q, one of %s", kind, strings.Join(config.Kinds, ", "))
+			}
+			target.Kinds = append(target.Kinds, kind)
+		}
+	}
+
+	target.Namespace = r.URL.Query().Get("namespace")
+	if target.Namespace == "" {
+		return target, nil
+	}
+	for _, kind := range target.Kinds {
+		if !slices.Contains(namespacedKinds, kind) {
+			return target, newHTTPError(http.StatusBadRequest, "%s are not namespaced, leave out the namespace to refresh them", kind)
+		}
+	}
+	if ov := cl.Overview(); ov == nil || !slices.Contains(ov.namespaceList(), target.Namespace) {
+		return target, newHTTPError(http.StatusNotFound, "namespace %s is not in the overview", target.Namespace)
+	}
+	return target, nil
+}
+
+// maxAgeParam reads the maxAge query parameter in seconds, def when it is
+// not given
+func maxAgeParam(r *http.Request, def time.Duration) (time.Duration, error) {
+	v := r.URL.Query().Get("maxAge")
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, newHTTPError(http.StatusBadRequest, "invalid maxAge %q, want seconds", v)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+func (s *Server) apiConfig(w http.ResponseWriter, r *http.Request) {
+	configBytes, err := s.readKubeconfig(w, r)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	reg, err := uploadRegistration(r)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	cl, err := s.connectKubeconfig(r.Context(), configBytes, reg)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, kubeconfigResponse(cl, "connected"))
+}
+
+func (s *Server) apiRestartPod(w http.ResponseWriter, r *http.Request) {
+	cl, ok := s.selectCluster(w, r)
+	if !ok {
+		return
+	}
+
+	ns, name := r.PathValue("namespace"), r.PathValue("name")
+	err := cl.DeletePod(r.Context(), ns, name)
+	if err != nil {
+		writeError(w, kubeStatus(err), "couldnt restart %s/%s: %s", ns, name, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &MessageResponse{Message: "restarted"})
+}
+
+func (s *Server) apiPodLogs(w http.ResponseWriter, r *http.Request) {
+	cl, ok := s.selectCluster(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	opts := LogOptions{Container: q.Get("container")}
+	if f := q.Get("follow"); f != "" {
+		follow, err := strconv.ParseBool(f)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid follow %q", f)
+			return
+		}
+		opts.Follow = follow
+	}
+	if t := q.Get("tail"); t != "" {
+		tail, err := strconv.ParseInt(t, 10, 64)
+		if err != nil || tail < 0 {
+			writeError(w, http.StatusBadRequest, "invalid tail %q", t)
+			return
+		}
+		opts.TailLines = tail
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(s.streams, cancel)
+	defer stop()
+
+	ns, name := r.PathValue("namespace"), r.PathValue("name")
+	stream, err := cl.PodLogs(ctx, ns, name, opts)
+	if err != nil {
+		writeError(w, kubeStatus(err), "couldnt get logs for %s/%s: %s", ns, name, err.Error())
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	// flush every line so followers see output as it happens
+	flusher, _ := w.(http.Flusher)
+	sc := bufio.NewScanner(stream)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if _, err := w.Write(append(sc.Bytes(), '\n')); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
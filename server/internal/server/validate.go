@@ -0,0 +1,279 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"server/internal/config"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// uploaded kubeconfigs come from whoever can reach the api, so anything that
+// would run a binary or read a file on this machine is refused unless the
+// operator allowed it
+
+type ValidationIssue struct {
+	Severity string `json:"severity"` // error or warning
+	Context  string `json:"context"`
+	Field    string `json:"field"` // e.g. users[alice].exec
+	Message  string `json:"message"`
+}
+
+// ClientCertificate is a client certificate found in the kubeconfig
+type ClientCertificate struct {
+	User     string    `json:"user"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"notAfter"`
+	Expired  bool      `json:"expired"`
+}
+
+// ValidationReport is the outcome of checking every context of a kubeconfig.
+// only errors on the context being connected stop it from being used
+type ValidationReport struct {
+	Valid        bool                 `json:"valid"` // no errors in any context
+	Issues       []*ValidationIssue   `json:"issues"`
+	Certificates []*ClientCertificate `json:"certificates"`
+}
+
+// InvalidKubeconfigResponse is the body of a rejected upload
+type InvalidKubeconfigResponse struct {
+	Error      *APIError         `json:"error"`
+	Validation *ValidationReport `json:"validation"`
+}
+
+// errorsFor returns the errors that block contextName
+func (rep *ValidationReport) errorsFor(contextName string) []*ValidationIssue {
+	var errs []*ValidationIssue
+	for _, is := range rep.Issues {
+		if is.Context == contextName && is.Severity == "error" {
+			errs = append(errs, is)
+		}
+	}
+	return errs
+}
+
+// warningsFor returns the warnings about contextName
+func (rep *ValidationReport) warningsFor(contextName string) []*ValidationIssue {
+	var warnings []*ValidationIssue
+	for _, is := range rep.Issues {
+		if is.Context == contextName && is.Severity == "warning" {
+			warnings = append(warnings, is)
+		}
+	}
+	return warnings
+}
+
+// invalidKubeconfigError rejects a context that failed validation
+type invalidKubeconfigError struct {
+	context string
+	report  *ValidationReport
+}
+
+func (e *invalidKubeconfigError) Error() string {
+	msgs := make([]string, 0)
+	for _, is := range e.report.errorsFor(e.context) {
+		msgs = append(msgs, is.Field+": "+is.Message)
+	}
+	return fmt.Sprintf("context %q can not be used: %s", e.context, strings.Join(msgs, "; "))
+}
+
+type validator struct {
+	policy config.Uploads
+	now    time.Time
+	report *ValidationReport
+}
+
+// validateKubeconfig checks every context of raw against the upload policy
+func validateKubeconfig(raw *clientcmdapi.Config, policy config.Uploads) *ValidationReport {
+	v := &validator{
+		policy: policy,
+		now:    time.Now(),
+		report: &ValidationReport{Valid: true, Issues: make([]*ValidationIssue, 0), Certificates: make([]*ClientCertificate, 0)},
+	}
+
+	for _, name := range contextNames(raw) {
+		c := raw.Contexts[name]
+
+		cluster, ok := raw.Clusters[c.Cluster]
+		if !ok {
+			v.fail(name, fmt.Sprintf("contexts[%s].cluster", name), "cluster %q is not in the kubeconfig", c.Cluster)
+		} else {
+			v.cluster(name, c.Cluster, cluster)
+		}
+
+		user, ok := raw.AuthInfos[c.AuthInfo]
+		if !ok {
+			v.fail(name, fmt.Sprintf("contexts[%s].user", name), "user %q is not in the kubeconfig", c.AuthInfo)
+		} else {
+			v.user(name, c.AuthInfo, user)
+		}
+	}
+
+	for _, user := range sortedUsers(raw) {
+		if cert := v.certificate(user, raw.AuthInfos[user]); cert != nil {
+			v.report.Certificates = append(v.report.Certificates, cert)
+		}
+	}
+
+	return v.report
+}
+
+func sortedUsers(raw *clientcmdapi.Config) []string {
+	users := make([]string, 0, len(raw.AuthInfos))
+	for name := range raw.AuthInfos {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+	return users
+}
+
+func (v *validator) add(severity, contextName, field, format string, args ...interface{}) {
+	if severity == "error" {
+		v.report.Valid = false
+	}
+	v.report.Issues = append(v.report.Issues, &ValidationIssue{
+		Severity: severity,
+		Context:  contextName,
+		Field:    field,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) fail(contextName, field, format string, args ...interface{}) {
+	v.add("error", contextName, field, format, args...)
+}
+
+func (v *validator) warn(contextName, field, format string, args ...interface{}) {
+	v.add("warning", contextName, field, format, args...)
+}
+
+func (v *validator) cluster(contextName, name string, c *clientcmdapi.Cluster) {
+	field := fmt.Sprintf("clusters[%s]", name)
+
+	u, err := url.Parse(c.Server)
+	switch {
+	case c.Server == "":
+		v.fail(contextName, field+".server", "no server address")
+	case err != nil || u.Host == "":
+		v.fail(contextName, field+".server", "%q is not a url", c.Server)
+	case u.Scheme == "http":
+		v.warn(contextName, field+".server", "plain http, credentials are sent unencrypted")
+	case u.Scheme != "https":
+		v.fail(contextName, field+".server", "scheme %q is not http or https", u.Scheme)
+	}
+
+	if c.CertificateAuthority != "" {
+		v.fail(contextName, field+".certificate-authority", "file paths are not allowed in uploads, inline the ca as certificate-authority-data")
+	}
+
+	if c.InsecureSkipTLSVerify {
+		if v.policy.AllowInsecureSkipTLSVerify {
+			v.warn(contextName, field+".insecure-skip-tls-verify", "the server certificate is not verified")
+		} else {
+			v.fail(contextName, field+".insecure-skip-tls-verify", "not allowed on this server, add the cluster ca instead")
+		}
+	}
+}
+
+// execAllowed reports whether exec runs the allow-list entry allowed, the
+// command and then every argument, where * matches any one argument
+func execAllowed(allowed string, exec *clientcmdapi.ExecConfig) bool {
+	words := strings.Fields(allowed)
+	if len(words) == 0 || words[0] != exec.Command || len(words)-1 != len(exec.Args) {
+		return false
+	}
+	for i, arg := range exec.Args {
+		if w := words[i+1]; w != "*" && w != arg {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *validator) user(contextName, name string, u *clientcmdapi.AuthInfo) {
+	field := fmt.Sprintf("users[%s]", name)
+
+	files := map[string]string{
+		"client-certificate": u.ClientCertificate,
+		"client-key":         u.ClientKey,
+		"tokenFile":          u.TokenFile,
+	}
+	for _, key := range []string{"client-certificate", "client-key", "tokenFile"} {
+		if files[key] != "" {
+			v.fail(contextName, field+"."+key, "file paths are not allowed in uploads, inline the contents instead")
+		}
+	}
+
+	if u.Exec != nil {
+		command := strings.Join(append([]string{u.Exec.Command}, u.Exec.Args...), " ")
+		switch {
+		case len(u.Exec.Env) > 0:
+			// LD_PRELOAD or PATH would run whatever the uploader likes
+			v.fail(contextName, field+".exec.env", "exec plugins may not set environment variables on this server")
+		case !slices.ContainsFunc(v.policy.AllowedExecCommands, func(allowed string) bool { return execAllowed(allowed, u.Exec) }):
+			v.fail(contextName, field+".exec", "exec plugin %q is not allowed on this server", command)
+		default:
+			v.warn(contextName, field+".exec", "runs %s on the server to get credentials", command)
+		}
+	}
+
+	if u.AuthProvider != nil && !slices.Contains(v.policy.AllowedAuthProviders, u.AuthProvider.Name) {
+		v.fail(contextName, field+".auth-provider", "auth provider %q is not allowed on this server", u.AuthProvider.Name)
+	}
+
+	if cert := v.certificate(name, u); cert != nil {
+		switch {
+		case cert.Expired:
+			v.fail(contextName, field+".client-certificate-data", "expired %s", cert.NotAfter.Format(time.RFC3339))
+		case cert.NotAfter.Sub(v.now) < v.policy.CertExpiryWarning.D():
+			v.warn(contextName, field+".client-certificate-data", "expires %s", cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
+// certificate parses the user's inline client certificate, nil if there is
+// none or it cant be read, clientcmd reports the latter when connecting
+func (v *validator) certificate(name string, u *clientcmdapi.AuthInfo) *ClientCertificate {
+	block, _ := pem.Decode(u.ClientCertificateData)
+	if block == nil {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil
+	}
+	return &ClientCertificate{
+		User:     name,
+		Subject:  cert.Subject.String(),
+		NotAfter: cert.NotAfter,
+		Expired:  v.now.After(cert.NotAfter),
+	}
+}
+
+// uploadLimit is how much of a request body readKubeconfig reads, the form
+// around the file needs a little room on top of the kubeconfig itself
+func (s *Server) uploadLimit() int64 {
+	return s.Config().Uploads.MaxSize + 64<<10
+}
+
+func (s *Server) apiValidateConfig(w http.ResponseWriter, r *http.Request) {
+	configBytes, err := s.readKubeconfig(w, r)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	raw, err := parseKubeconfig(configBytes)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, validateKubeconfig(raw, s.Config().Uploads))
+}
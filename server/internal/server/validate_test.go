@@ -0,0 +1,195 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"server/internal/config"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// certPEM is a self signed client certificate for alice valid until notAfter
+func certPEM(t *testing.T, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "alice"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// uploadedKubeconfig is a kubeconfig with one context prod for the user alice
+// with a token, which passes every check
+func uploadedKubeconfig() *clientcmdapi.Config {
+	raw := clientcmdapi.NewConfig()
+	raw.Clusters["prod"] = &clientcmdapi.Cluster{Server: "https://prod.example.com:6443"}
+	raw.AuthInfos["alice"] = &clientcmdapi.AuthInfo{Token: "t0ken"}
+	raw.Contexts["prod"] = &clientcmdapi.Context{Cluster: "prod", AuthInfo: "alice"}
+	raw.CurrentContext = "prod"
+	return raw
+}
+
+func TestValidateKubeconfig(t *testing.T) {
+	exec := func(command string, args ...string) func(*clientcmdapi.Config) {
+		return func(raw *clientcmdapi.Config) {
+			raw.AuthInfos["alice"].Exec = &clientcmdapi.ExecConfig{Command: command, Args: args}
+		}
+	}
+	eks := []string{"aws --region * eks get-token --cluster-name *"}
+
+	tests := []struct {
+		name   string
+		policy config.Uploads
+		edit   func(raw *clientcmdapi.Config)
+		// the issues as severity and field
+		want []string
+	}{
+		{name: "clean", edit: func(*clientcmdapi.Config) {}},
+
+		// servers
+		{name: "plain http", edit: func(raw *clientcmdapi.Config) { raw.Clusters["prod"].Server = "http://prod:8080" },
+			want: []string{"warning clusters[prod].server"}},
+		{name: "no server", edit: func(raw *clientcmdapi.Config) { raw.Clusters["prod"].Server = "" },
+			want: []string{"error clusters[prod].server"}},
+		{name: "other scheme", edit: func(raw *clientcmdapi.Config) { raw.Clusters["prod"].Server = "ftp://prod" },
+			want: []string{"error clusters[prod].server"}},
+		{name: "missing cluster and user", edit: func(raw *clientcmdapi.Config) {
+			raw.Contexts["prod"] = &clientcmdapi.Context{Cluster: "gone", AuthInfo: "bob"}
+		},
+			want: []string{"error contexts[prod].cluster", "error contexts[prod].user"}},
+
+		// insecure-skip-tls-verify
+		{name: "insecure skip tls verify", edit: func(raw *clientcmdapi.Config) { raw.Clusters["prod"].InsecureSkipTLSVerify = true },
+			want: []string{"error clusters[prod].insecure-skip-tls-verify"}},
+		{name: "insecure skip tls verify allowed", policy: config.Uploads{AllowInsecureSkipTLSVerify: true},
+			edit: func(raw *clientcmdapi.Config) { raw.Clusters["prod"].InsecureSkipTLSVerify = true },
+			want: []string{"warning clusters[prod].insecure-skip-tls-verify"}},
+
+		// file references
+		{name: "ca file", edit: func(raw *clientcmdapi.Config) { raw.Clusters["prod"].CertificateAuthority = "/etc/ca.crt" },
+			want: []string{"error clusters[prod].certificate-authority"}},
+		{name: "client certificate files", edit: func(raw *clientcmdapi.Config) {
+			raw.AuthInfos["alice"].ClientCertificate = "/home/alice/.kube/alice.crt"
+			raw.AuthInfos["alice"].ClientKey = "/home/alice/.kube/alice.key"
+		}, want: []string{"error users[alice].client-certificate", "error users[alice].client-key"}},
+		{name: "token file", edit: func(raw *clientcmdapi.Config) { raw.AuthInfos["alice"].TokenFile = "/var/run/token" },
+			want: []string{"error users[alice].tokenFile"}},
+
+		// exec plugins
+		{name: "exec not allowed", edit: exec("aws", "eks", "get-token"),
+			want: []string{"error users[alice].exec"}},
+		{name: "exec allowed", policy: config.Uploads{AllowedExecCommands: []string{"/usr/local/bin/gke-gcloud-auth-plugin"}},
+			edit: exec("/usr/local/bin/gke-gcloud-auth-plugin"),
+			want: []string{"warning users[alice].exec"}},
+		{name: "exec with arguments the entry has not", policy: config.Uploads{AllowedExecCommands: []string{"/usr/local/bin/gke-gcloud-auth-plugin"}},
+			edit: exec("/usr/local/bin/gke-gcloud-auth-plugin", "--use_application_default_credentials"),
+			want: []string{"error users[alice].exec"}},
+		{name: "exec matching the wildcards", policy: config.Uploads{AllowedExecCommands: eks},
+			edit: exec("aws", "--region", "eu-west-1", "eks", "get-token", "--cluster-name", "prod"),
+			want: []string{"warning users[alice].exec"}},
+		{name: "exec with an argument too many", policy: config.Uploads{AllowedExecCommands: eks},
+			edit: exec("aws", "--region", "eu-west-1", "eks", "get-token", "--cluster-name", "prod", "--profile"),
+			want: []string{"error users[alice].exec"}},
+		{name: "exec with an argument too few", policy: config.Uploads{AllowedExecCommands: eks},
+			edit: exec("aws", "--region", "eu-west-1", "eks", "get-token", "--cluster-name"),
+			want: []string{"error users[alice].exec"}},
+		{name: "exec with another literal argument", policy: config.Uploads{AllowedExecCommands: eks},
+			edit: exec("aws", "--region", "eu-west-1", "s3", "get-token", "--cluster-name", "prod"),
+			want: []string{"error users[alice].exec"}},
+		{name: "exec with another command", policy: config.Uploads{AllowedExecCommands: eks},
+			edit: exec("/tmp/aws", "--region", "eu-west-1", "eks", "get-token", "--cluster-name", "prod"),
+			want: []string{"error users[alice].exec"}},
+		{name: "exec wildcard is one argument", policy: config.Uploads{AllowedExecCommands: []string{"kubelogin *"}},
+			edit: exec("kubelogin", "get-token", "--server-id", "x"),
+			want: []string{"error users[alice].exec"}},
+		{name: "exec setting env", policy: config.Uploads{AllowedExecCommands: []string{"kubelogin *"}},
+			edit: func(raw *clientcmdapi.Config) {
+				raw.AuthInfos["alice"].Exec = &clientcmdapi.ExecConfig{
+					Command: "kubelogin", Args: []string{"get-token"},
+					Env: []clientcmdapi.ExecEnvVar{{Name: "LD_PRELOAD", Value: "/tmp/evil.so"}},
+				}
+			},
+			want: []string{"error users[alice].exec.env"}},
+
+		// auth providers
+		{name: "auth provider not allowed", edit: func(raw *clientcmdapi.Config) {
+			raw.AuthInfos["alice"].AuthProvider = &clientcmdapi.AuthProviderConfig{Name: "gcp"}
+		}, want: []string{"error users[alice].auth-provider"}},
+		{name: "auth provider allowed", policy: config.Uploads{AllowedAuthProviders: []string{"oidc"}}, edit: func(raw *clientcmdapi.Config) {
+			raw.AuthInfos["alice"].AuthProvider = &clientcmdapi.AuthProviderConfig{Name: "oidc"}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := uploadedKubeconfig()
+			tt.edit(raw)
+			rep := validateKubeconfig(raw, tt.policy)
+
+			got := make([]string, 0)
+			for _, is := range rep.Issues {
+				got = append(got, is.Severity+" "+is.Field)
+			}
+			if tt.want == nil {
+				tt.want = []string{}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("issues = %q, want %q", got, tt.want)
+			}
+			if valid := !slices.ContainsFunc(rep.Issues, func(is *ValidationIssue) bool { return is.Severity == "error" }); rep.Valid != valid {
+				t.Errorf("valid = %v with issues %q", rep.Valid, got)
+			}
+		})
+	}
+}
+
+func TestValidateCertificateExpiry(t *testing.T) {
+	policy := config.Uploads{CertExpiryWarning: config.Duration(30 * 24 * time.Hour)}
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		want     []string
+	}{
+		{"valid for long", time.Now().Add(365 * 24 * time.Hour), []string{}},
+		{"expiring soon", time.Now().Add(7 * 24 * time.Hour), []string{"warning users[alice].client-certificate-data"}},
+		{"expired", time.Now().Add(-time.Hour), []string{"error users[alice].client-certificate-data"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := uploadedKubeconfig()
+			raw.AuthInfos["alice"] = &clientcmdapi.AuthInfo{ClientCertificateData: certPEM(t, tt.notAfter), ClientKeyData: []byte("key")}
+			rep := validateKubeconfig(raw, policy)
+
+			got := make([]string, 0)
+			for _, is := range rep.Issues {
+				got = append(got, is.Severity+" "+is.Field)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("issues = %q, want %q", got, tt.want)
+			}
+			if len(rep.Certificates) != 1 || rep.Certificates[0].User != "alice" || rep.Certificates[0].Subject != "CN=alice" {
+				t.Errorf("certificates = %+v, want alice's", rep.Certificates)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+// Package store keeps small records on disk encrypted with AES-GCM. the key
+// for every record is derived from a master secret with HKDF and a random
+// salt, so rotating the secret only needs the old one around long enough to
+// read the records back once.
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const recordInfo = "kube monitering store v1"
+
+// ErrNotFound is returned for names with no record
+var ErrNotFound = errors.New("no such record")
+
+// ErrInvalidName is returned for names that would put a record outside the
+// store directory
+var ErrInvalidName = errors.New("invalid record name")
+
+// ErrUnknownKey means the record was written with a secret the keyring does
+// not have anymore
+var ErrUnknownKey = errors.New("record was encrypted with an unknown secret")
+
+type secret struct {
+	id    string // short fingerprint, stored next to every record
+	value []byte
+}
+
+// Keyring is the current master secret plus any previous ones that records
+// may still be encrypted with
+type Keyring struct {
+	current  *secret
+	previous []*secret
+}
+
+func NewKeyring(current []byte, previous ...[]byte) (*Keyring, error) {
+	cur, err := newSecret(current)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{current: cur}
+	for _, p := range previous {
+		s, err := newSecret(p)
+		if err != nil {
+			return nil, fmt.Errorf("previous secret: %w", err)
+		}
+		k.previous = append(k.previous, s)
+	}
+	return k, nil
+}
+
+func newSecret(value []byte) (*secret, error) {
+	value = []byte(strings.TrimSpace(string(value)))
+	if len(value) < 32 {
+		return nil, errors.New("master secret must be at least 32 bytes")
+	}
+	sum := sha256.Sum256(append([]byte("kube monitering key id\x00"), value...))
+	return &secret{id: hex.EncodeToString(sum[:8]), value: value}, nil
+}
+
+// CurrentID is the fingerprint of the secret new records are written with
+func (k *Keyring) CurrentID() string {
+	return k.current.id
+}
+
+// Derive returns a 32 byte key for purpose from the current secret, e.g. for
+// cookie signing keys that should survive restarts
+func (k *Keyring) Derive(purpose string) ([]byte, error) {
+	return hkdf.Key(sha256.New, k.current.value, nil, purpose, 32)
+}
+
+func (k *Keyring) byID(id string) *secret {
+	if k.current.id == id {
+		return k.current
+	}
+	for _, p := range k.previous {
+		if p.id == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// envelope is what ends up in the file
+type envelope struct {
+	Version    int       `json:"version"`
+	KeyID      string    `json:"keyId"`
+	Salt       []byte    `json:"salt"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+	SavedAt    time.Time `json:"savedAt"`
+}
+
+// Entry describes a stored record without decrypting it
+type Entry struct {
+	Name    string    `json:"name"`
+	KeyID   string    `json:"keyId"`
+	SavedAt time.Time `json:"savedAt"`
+	// the record needs a previous secret and is rewritten on the next Rotate
+	Stale bool `json:"stale"`
+	// the file cant be read or was encrypted with a secret we dont have
+	Error string `json:"error,omitempty"`
+}
+
+// Store is a directory of encrypted records, one file per name
+type Store struct {
+	dir  string
+	keys *Keyring
+}
+
+func Open(dir string, keys *Keyring) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, keys: keys}, nil
+}
+
+// KeyID is the fingerprint of the secret new records are written with
+func (s *Store) KeyID() string {
+	return s.keys.CurrentID()
+}
+
+// path is the file of the record called name. names are file names, never
+// paths, so nothing a caller passes in reaches outside dir
+func (s *Store) path(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.Contains(name, "..") || strings.ContainsAny(name, `/\`+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w %q", ErrInvalidName, name)
+	}
+	p := filepath.Join(s.dir, name+".json")
+	if filepath.Dir(p) != filepath.Clean(s.dir) {
+		return "", fmt.Errorf("%w %q", ErrInvalidName, name)
+	}
+	return p, nil
+}
+
+func aead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds a record to its name so files cant be swapped around
+func additionalData(name, keyID string) []byte {
+	return []byte(name + "\x00" + keyID)
+}
+
+// Put encrypts data with the current secret and writes it under name
+func (s *Store) Put(name string, data []byte) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	env := &envelope{Version: 1, KeyID: s.keys.current.id, Salt: make([]byte, 32), SavedAt: time.Now().UTC()}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return err
+	}
+
+	key, err := hkdf.Key(sha256.New, s.keys.current.value, env.Salt, recordInfo, 32)
+	if err != nil {
+		return err
+	}
+	gcm, err := aead(key)
+	if err != nil {
+		return err
+	}
+	env.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return err
+	}
+	env.Ciphertext = gcm.Seal(nil, env.Nonce, data, additionalData(name, env.KeyID))
+
+	b, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// writeFileAtomic replaces path in one go so a crash never leaves half a
+// record behind
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Store) read(name string) (*envelope, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if env.Version != 1 {
+		return nil, fmt.Errorf("%s: unknown record version %d", name, env.Version)
+	}
+	return &env, nil
+}
+
+// Get decrypts the record called name. stale reports that it was written
+// with a previous secret
+func (s *Store) Get(name string) (data []byte, stale bool, err error) {
+	env, err := s.read(name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sec := s.keys.byID(env.KeyID)
+	if sec == nil {
+		return nil, false, ErrUnknownKey
+	}
+	key, err := hkdf.Key(sha256.New, sec.value, env.Salt, recordInfo, 32)
+	if err != nil {
+		return nil, false, err
+	}
+	gcm, err := aead(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(env.Nonce) != gcm.NonceSize() {
+		return nil, false, fmt.Errorf("%s: bad nonce", name)
+	}
+
+	data, err = gcm.Open(nil, env.Nonce, env.Ciphertext, additionalData(name, env.KeyID))
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: record does not decrypt, it was changed or the secret is wrong", name)
+	}
+	return data, sec != s.keys.current, nil
+}
+
+// List describes every record, including the ones that cant be decrypted
+func (s *Store) List() ([]*Entry, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(files))
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok || f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
+		e := &Entry{Name: name}
+		env, err := s.read(name)
+		if err != nil {
+			e.Error = err.Error()
+			entries = append(entries, e)
+			continue
+		}
+		e.KeyID = env.KeyID
+		e.SavedAt = env.SavedAt
+		sec := s.keys.byID(env.KeyID)
+		switch {
+		case sec == nil:
+			e.Error = ErrUnknownKey.Error()
+		case sec != s.keys.current:
+			e.Stale = true
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// Delete forgets the record called name
+func (s *Store) Delete(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Rotate rewrites every record written with a previous secret using the
+// current one. records that cant be read are left alone and reported
+func (s *Store) Rotate() (rotated int, err error) {
+	entries, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	for _, e := range entries {
+		switch {
+		case e.Error != "":
+			errs = append(errs, fmt.Errorf("%s: %s", e.Name, e.Error))
+			continue
+		case !e.Stale:
+			continue
+		}
+		data, _, err := s.Get(e.Name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.Put(e.Name, data); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rotated++
+	}
+	return rotated, errors.Join(errs...)
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// secretOf is a master secret of 32 bytes made of c
+func secretOf(c byte) []byte {
+	return bytes.Repeat([]byte{c}, 32)
+}
+
+func openStore(t *testing.T, dir string, current []byte, previous ...[]byte) *Store {
+	t.Helper()
+	keys, err := NewKeyring(current, previous...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(dir, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRoundTrip(t *testing.T) {
+	s := openStore(t, t.TempDir(), secretOf('a'))
+	want := []byte(`{"server":"https://prod:6443"}`)
+	if err := s.Put("prod", want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, stale, err := s.Get("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) || stale {
+		t.Errorf("Get = %q stale %v, want %q fresh", got, stale, want)
+	}
+
+	// the plaintext is nowhere in the file
+	raw, err := os.ReadFile(filepath.Join(s.dir, "prod.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("prod:6443")) {
+		t.Error("record is stored in the clear")
+	}
+
+	if _, _, err := s.Get("dev"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing record = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRenamedRecord(t *testing.T) {
+	s := openStore(t, t.TempDir(), secretOf('a'))
+	if err := s.Put("dev", []byte("dev credentials")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a record moved to another name does not pass for that one
+	if err := os.Rename(filepath.Join(s.dir, "dev.json"), filepath.Join(s.dir, "prod.json")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _, err := s.Get("prod"); err == nil {
+		t.Errorf("renamed record decrypted to %q", data)
+	}
+}
+
+func TestTamperedRecord(t *testing.T) {
+	s := openStore(t, t.TempDir(), secretOf('a'))
+	if err := s.Put("prod", []byte("prod credentials")); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(s.dir, "prod.json")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		t.Fatal(err)
+	}
+	env.Ciphertext[0] ^= 1
+	raw, err = json.Marshal(&env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _, err := s.Get("prod"); err == nil {
+		t.Errorf("tampered record decrypted to %q", data)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	old := openStore(t, dir, secretOf('a'))
+	for _, name := range []string{"dev", "prod"} {
+		if err := old.Put(name, []byte(name+" credentials")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// written with a secret the new keyring does not know
+	if err := openStore(t, dir, secretOf('x')).Put("lost", []byte("lost credentials")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := openStore(t, dir, secretOf('b'), secretOf('a'))
+	if _, stale, err := s.Get("dev"); err != nil || !stale {
+		t.Fatalf("Get before rotating = stale %v, %v, want stale", stale, err)
+	}
+
+	rotated, err := s.Rotate()
+	if rotated != 2 {
+		t.Errorf("rotated %d records, want 2", rotated)
+	}
+	if err == nil || !strings.Contains(err.Error(), "lost") {
+		t.Errorf("Rotate error = %v, want the record with the unknown secret", err)
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		switch e.Name {
+		case "lost":
+			if e.Error != ErrUnknownKey.Error() {
+				t.Errorf("lost record error %q, want %q", e.Error, ErrUnknownKey)
+			}
+		default:
+			if e.Stale || e.KeyID != s.KeyID() {
+				t.Errorf("%s not rotated: stale %v key %s", e.Name, e.Stale, e.KeyID)
+			}
+		}
+	}
+
+	// the old secret is not needed anymore
+	s = openStore(t, dir, secretOf('b'))
+	if data, stale, err := s.Get("prod"); err != nil || stale || string(data) != "prod credentials" {
+		t.Errorf("Get after rotating = %q stale %v, %v", data, stale, err)
+	}
+}
+
+func TestInvalidNames(t *testing.T) {
+	s := openStore(t, t.TempDir(), secretOf('a'))
+	for _, name := range []string{"", ".", "..", "../prod", "..%2Fprod", "a/b", "/etc/passwd", `a\b`, `..\prod`, ".hidden", "a..b"} {
+		if _, err := s.path(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("path(%q) = %v, want ErrInvalidName", name, err)
+		}
+		if err := s.Put(name, []byte("x")); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidName", name, err)
+		}
+		if _, _, err := s.Get(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Get(%q) = %v, want ErrInvalidName", name, err)
+		}
+		if err := s.Delete(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidName", name, err)
+		}
+	}
+
+	for _, name := range []string{"prod", "prod-eu.1", "team_a"} {
+		if _, err := s.path(name); err != nil {
+			t.Errorf("path(%q) = %v, want ok", name, err)
+		}
+	}
+}
@@ -0,0 +1,652 @@
+// Package client talks to the dashboard server's /api/v1 surface.
+//
+//	c, err := client.New("https://kubemon:8443", client.WithClientCert("alice.crt", "alice.key"), client.WithServerCA("ca.crt"))
+//	ov, err := c.Overview(ctx)
+package client
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiPrefix = "/api/v1"
+
+// Error is a non 2xx answer from the server. a rejected kubeconfig comes
+// with the report of every issue the server found in it
+type Error struct {
+	StatusCode int
+	Message    string
+	Validation *ValidationReport
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsStatus reports whether err is an *Error with the given status code
+func IsStatus(err error, code int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == code
+}
+
+type Client struct {
+	base      string
+	http      *http.Client
+	token     string
+	userAgent string
+	cluster   string
+	tlsConfig *tls.Config
+	// the first option that failed, New returns it
+	err error
+
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces the default http client. its transport has to do
+// the tls itself, the tls options need the default one
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithToken sends token as a bearer token on every request. the server does
+// not check it, it is for a proxy in front of the server that does. the
+// server itself knows users by their client certificate, see WithClientCert
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithTLSConfig sets the tls settings for talking to an https server
+func WithTLSConfig(tc *tls.Config) Option {
+	return func(c *Client) { c.tlsConfig = tc }
+}
+
+// WithClientCert authenticates with the client certificate in certFile and
+// keyFile, which the server maps to a user when it runs with
+// tls.clientCAFile
+func WithClientCert(certFile, keyFile string) Option {
+	return func(c *Client) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			c.err = cmp.Or(c.err, fmt.Errorf("kubemon: client certificate: %w", err))
+			return
+		}
+		c.tlsSettings().Certificates = []tls.Certificate{cert}
+	}
+}
+
+// WithServerCA checks the server's certificate against the ca in caFile
+// instead of the system roots
+func WithServerCA(caFile string) Option {
+	return func(c *Client) {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			c.err = cmp.Or(c.err, fmt.Errorf("kubemon: server ca: %w", err))
+			return
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			c.err = cmp.Or(c.err, fmt.Errorf("kubemon: server ca: no certificates in %s", caFile))
+			return
+		}
+		c.tlsSettings().RootCAs = pool
+	}
+}
+
+// tlsSettings is a copy of the tls settings for an option to change, the
+// copy becomes the client's
+func (c *Client) tlsSettings() *tls.Config {
+	tc := c.tlsConfig.Clone()
+	if tc == nil {
+		tc = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	c.tlsConfig = tc
+	return tc
+}
+
+// WithRetries sets how often idempotent requests are retried and the backoff
+// bounds between attempts
+func WithRetries(n int, min, max time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// WithCluster makes every request about the registered cluster called name
+// instead of the server's current one
+func WithCluster(name string) Option {
+	return func(c *Client) { c.cluster = name }
+}
+
+// New returns a client for the server at baseURL, including any route prefix
+// the server runs under (WITH_INGRESS)
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("kubemon: base url %q needs an http or https scheme", baseURL)
+	}
+
+	// keep session cookies around in case the server hands any out
+	jar, _ := cookiejar.New(nil)
+
+	c := &Client{
+		base:       strings.TrimSuffix(u.String(), "/"),
+		http:       &http.Client{Jar: jar},
+		userAgent:  "kubemon-client",
+		retries:    3,
+		minBackoff: 200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	if c.tlsConfig != nil {
+		if c.http.Transport != nil {
+			return nil, errors.New("kubemon: tls options need the default transport, set tls on the transport of the http client instead")
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = c.tlsConfig
+		hc := *c.http
+		hc.Transport = t
+		c.http = &hc
+	}
+
+	return c, nil
+}
+
+// request is one call, body is rebuilt for every attempt
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        func() (io.Reader, error)
+	contentType string
+}
+
+func (c *Client) newRequest(ctx context.Context, req *request) (*http.Request, error) {
+	u := c.base + apiPrefix + req.path
+	query := url.Values{}
+	for k, v := range req.query {
+		query[k] = v
+	}
+	if c.cluster != "" {
+		query.Set("cluster", c.cluster)
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		b, err := req.body()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	r, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if req.contentType != "" {
+		r.Header.Set("Content-Type", req.contentType)
+	}
+	if c.token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	r.Header.Set("User-Agent", c.userAgent)
+	r.Header.Set("Accept", "application/json")
+
+	return r, nil
+}
+
+// send runs req, retrying idempotent requests on network errors, 429 and 5xx.
+// the returned response has a 2xx status, anything else comes back as *Error
+func (c *Client) send(ctx context.Context, req *request) (*http.Response, error) {
+	idempotent := req.method == http.MethodGet || req.method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		r, err := c.newRequest(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.http.Do(r)
+		if err == nil && res.StatusCode < 300 {
+			return res, nil
+		}
+
+		var retryAfter time.Duration
+		if err == nil {
+			apiErr := decodeError(res)
+			retryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+			res.Body.Close()
+			err = apiErr
+			if !retriable(res.StatusCode) {
+				return nil, err
+			}
+		}
+
+		if !idempotent || attempt >= c.retries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		wait := c.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func retriable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// backoff doubles per attempt up to maxBackoff with full jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.minBackoff << attempt
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(d)))
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func decodeError(res *http.Response) error {
+	var body struct {
+		Error *struct {
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Validation *ValidationReport `json:"validation"`
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if json.Unmarshal(b, &body) == nil && body.Error != nil {
+		return &Error{StatusCode: res.StatusCode, Message: body.Error.Message, Validation: body.Validation}
+	}
+	return &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(b))}
+}
+
+// do sends req and decodes the json answer into out, out may be nil
+func (c *Client) do(ctx context.Context, req *request, out interface{}) error {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// sendJSON sends in as a json body and decodes the answer into out
+func (c *Client) sendJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, &request{
+		method:      method,
+		path:        path,
+		body:        func() (io.Reader, error) { return bytes.NewReader(body), nil },
+		contentType: "application/json",
+	}, out)
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.do(ctx, &request{method: http.MethodGet, path: path, query: query}, out)
+}
+
+func (c *Client) Overview(ctx context.Context) (*Overview, error) {
+	var ov Overview
+	if err := c.get(ctx, "/overview", nil, &ov); err != nil {
+		return nil, err
+	}
+	return &ov, nil
+}
+
+func (c *Client) Pods(ctx context.Context) (*Pods, error) {
+	var res struct {
+		Pods *Pods `json:"pods"`
+	}
+	if err := c.get(ctx, "/pods", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Pods, nil
+}
+
+func (c *Client) Nodes(ctx context.Context) (*Nodes, error) {
+	var res struct {
+		Nodes *Nodes `json:"nodes"`
+	}
+	if err := c.get(ctx, "/nodes", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Nodes, nil
+}
+
+// NodePods is the node called name and the pods scheduled on it
+func (c *Client) NodePods(ctx context.Context, name string) (*NodePods, error) {
+	var res NodePods
+	if err := c.get(ctx, "/nodes/"+url.PathEscape(name)+"/pods", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) Services(ctx context.Context) (*Services, error) {
+	var res struct {
+		Services *Services `json:"services"`
+	}
+	if err := c.get(ctx, "/services", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Services, nil
+}
+
+func (c *Client) Ingress(ctx context.Context) (*Ingress, error) {
+	var res struct {
+		Ingress *Ingress `json:"ingress"`
+	}
+	if err := c.get(ctx, "/ingress", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Ingress, nil
+}
+
+func (c *Client) Secrets(ctx context.Context) (*Secrets, error) {
+	var res struct {
+		Secrets *Secrets `json:"secrets"`
+	}
+	if err := c.get(ctx, "/secrets", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Secrets, nil
+}
+
+func (c *Client) ConfigMaps(ctx context.Context) (*ConfigMaps, error) {
+	var res struct {
+		ConfigMaps *ConfigMaps `json:"configmaps"`
+	}
+	if err := c.get(ctx, "/configmaps", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.ConfigMaps, nil
+}
+
+// Search finds objects matching q, limit 0 returns everything
+func (c *Client) Search(ctx context.Context, q string, limit int) (*SearchResponse, error) {
+	var res SearchResponse
+	query := url.Values{"q": {q}, "limit": {strconv.Itoa(limit)}}
+	if err := c.get(ctx, "/search", query, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) OpenAPI(ctx context.Context) (*OpenAPIDoc, error) {
+	var doc OpenAPIDoc
+	if err := c.get(ctx, "/openapi.json", nil, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// WhoAmI is the user the server authenticated the client as, anonymous
+// without a client certificate
+func (c *Client) WhoAmI(ctx context.Context) (*Identity, error) {
+	var id Identity
+	if err := c.get(ctx, "/whoami", nil, &id); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// RefreshOptions limit what a refresh does
+type RefreshOptions struct {
+	// an overview loaded more recently is kept, 0 always refreshes
+	MaxAge time.Duration
+	// only these kinds, all of them when empty
+	Kinds []string
+	// only this namespace of the namespaced kinds
+	Namespace string
+}
+
+// Refresh makes the server reload its overview from the cluster
+func (c *Client) Refresh(ctx context.Context, opts RefreshOptions) (*RefreshResponse, error) {
+	query := url.Values{}
+	if opts.MaxAge > 0 {
+		query.Set("maxAge", strconv.Itoa(int(opts.MaxAge.Seconds())))
+	}
+	if len(opts.Kinds) > 0 {
+		query.Set("kind", strings.Join(opts.Kinds, ","))
+	}
+	if opts.Namespace != "" {
+		query.Set("namespace", opts.Namespace)
+	}
+	var res RefreshResponse
+	if err := c.do(ctx, &request{method: http.MethodPost, path: "/refresh", query: query}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RestartPod deletes the pod so its controller recreates it
+func (c *Client) RestartPod(ctx context.Context, namespace, name string) error {
+	path := fmt.Sprintf("/pods/%s/%s/restart", url.PathEscape(namespace), url.PathEscape(name))
+	return c.do(ctx, &request{method: http.MethodPost, path: path}, nil)
+}
+
+// UploadOptions pick what an uploaded kubeconfig is registered as, all of
+// them are optional
+type UploadOptions struct {
+	Context   string // current-context when empty
+	Namespace string
+	Name      string // the context name when empty
+	Labels    map[string]string
+	// the only namespaces to show, for credentials without cluster-wide
+	// list rights
+	Namespaces []string
+}
+
+// UploadKubeconfig sends a kubeconfig and registers the cluster of one of its
+// contexts as the server's current cluster
+func (c *Client) UploadKubeconfig(ctx context.Context, kubeconfig []byte, opts UploadOptions) (*KubeconfigResponse, error) {
+	labels := make([]string, 0, len(opts.Labels))
+	for k, v := range opts.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	req, err := kubeconfigRequest("/config", kubeconfig, map[string]string{
+		"context":    opts.Context,
+		"namespace":  opts.Namespace,
+		"name":       opts.Name,
+		"labels":     strings.Join(labels, ","),
+		"namespaces": strings.Join(opts.Namespaces, ","),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res KubeconfigResponse
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ValidateKubeconfig checks a kubeconfig against the server's upload policy
+// without connecting to any of its clusters. a kubeconfig the policy rejects
+// is no error, the report says why
+func (c *Client) ValidateKubeconfig(ctx context.Context, kubeconfig []byte) (*ValidationReport, error) {
+	req, err := kubeconfigRequest("/config/validate", kubeconfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res ValidationReport
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// kubeconfigRequest posts kubeconfig as the file of a multipart form to path,
+// with the fields that are set
+func kubeconfigRequest(path string, kubeconfig []byte, fields map[string]string) (*request, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", "config")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(kubeconfig); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		if v == "" {
+			continue
+		}
+		if err := mw.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	body := buf.Bytes()
+	return &request{
+		method:      http.MethodPost,
+		path:        path,
+		body:        func() (io.Reader, error) { return bytes.NewReader(body), nil },
+		contentType: mw.FormDataContentType(),
+	}, nil
+}
+
+// Context lists the contexts of the kubeconfig the server is connected with
+func (c *Client) Context(ctx context.Context) (*KubeconfigResponse, error) {
+	var res KubeconfigResponse
+	if err := c.get(ctx, "/context", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UseContext switches the server to another context of its kubeconfig, an
+// empty namespace keeps the one set on the context
+func (c *Client) UseContext(ctx context.Context, contextName, namespace string) (*KubeconfigResponse, error) {
+	var res KubeconfigResponse
+	body := map[string]string{"context": contextName, "namespace": namespace}
+	if err := c.sendJSON(ctx, http.MethodPut, "/context", body, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) Clusters(ctx context.Context) (*ClustersResponse, error) {
+	var res ClustersResponse
+	if err := c.get(ctx, "/clusters", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RegisterCluster adds another context of a kubeconfig the server already
+// has, see ClusterRegistration.From
+func (c *Client) RegisterCluster(ctx context.Context, reg *ClusterRegistration) (*ClusterInfo, error) {
+	var res ClusterInfo
+	if err := c.sendJSON(ctx, http.MethodPost, "/clusters", reg, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) RemoveCluster(ctx context.Context, name string) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: "/clusters/" + url.PathEscape(name)}, nil)
+}
+
+// StoredClusters lists the clusters the server saved for its next start
+func (c *Client) StoredClusters(ctx context.Context) (*StoredClustersResponse, error) {
+	var res StoredClustersResponse
+	if err := c.get(ctx, "/stored-clusters", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ForgetStoredCluster deletes a saved cluster, a connected one stays
+// connected until the server restarts
+func (c *Client) ForgetStoredCluster(ctx context.Context, name string) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: "/stored-clusters/" + url.PathEscape(name)}, nil)
+}
+
+// Fleet sums up every registered cluster, selector like "env=prod" narrows it
+// down by cluster labels
+func (c *Client) Fleet(ctx context.Context, selector string) (*FleetResponse, error) {
+	var res FleetResponse
+	var query url.Values
+	if selector != "" {
+		query = url.Values{"selector": {selector}}
+	}
+	if err := c.get(ctx, "/fleet", query, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
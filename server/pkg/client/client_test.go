@@ -0,0 +1,561 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient is a client for a server answering with h, without backoff
+// between retries
+func newTestClient(t *testing.T, h http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	opts = append([]Option{WithRetries(2, 0, 0)}, opts...)
+	c, err := New(srv.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEndpoints(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		call   func(c *Client) (any, error)
+		method string
+		path   string
+		query  string
+		body   string
+		// what the call returned, as fmt prints it
+		want string
+	}{
+		{
+			name:   "overview",
+			call:   func(c *Client) (any, error) { ov, err := c.Overview(ctx); return ov.Generation, err },
+			method: http.MethodGet, path: "/api/v1/overview",
+			body: `{"generation":3}`, want: "3",
+		},
+		{
+			name:   "pods",
+			call:   func(c *Client) (any, error) { p, err := c.Pods(ctx); return p.PodsList[0].Name, err },
+			method: http.MethodGet, path: "/api/v1/pods",
+			body: `{"pods":{"pods":[{"name":"web"}]}}`, want: "web",
+		},
+		{
+			name:   "nodes",
+			call:   func(c *Client) (any, error) { n, err := c.Nodes(ctx); return n.Nodes[0].Name, err },
+			method: http.MethodGet, path: "/api/v1/nodes",
+			body: `{"nodes":{"nodes":[{"name":"node1"}]}}`, want: "node1",
+		},
+		{
+			name:   "node pods",
+			call:   func(c *Client) (any, error) { n, err := c.NodePods(ctx, "node/1"); return len(n.Pods), err },
+			method: http.MethodGet, path: "/api/v1/nodes/node%2F1/pods",
+			body: `{"node":{"name":"node/1"},"pods":[{"name":"a"},{"name":"b"}]}`, want: "2",
+		},
+		{
+			name:   "services",
+			call:   func(c *Client) (any, error) { s, err := c.Services(ctx); return s.ServiceList[0].Name, err },
+			method: http.MethodGet, path: "/api/v1/services",
+			body: `{"services":{"services":[{"name":"web"}]}}`, want: "web",
+		},
+		{
+			name:   "ingress",
+			call:   func(c *Client) (any, error) { i, err := c.Ingress(ctx); return i.IngressList[0].Name, err },
+			method: http.MethodGet, path: "/api/v1/ingress",
+			body: `{"ingress":{"ingress":[{"name":"web"}]}}`, want: "web",
+		},
+		{
+			name:   "secrets",
+			call:   func(c *Client) (any, error) { s, err := c.Secrets(ctx); return s.Secrets[0].Name, err },
+			method: http.MethodGet, path: "/api/v1/secrets",
+			body: `{"secrets":{"secrets":[{"name":"tls"}]}}`, want: "tls",
+		},
+		{
+			name:   "configmaps",
+			call:   func(c *Client) (any, error) { m, err := c.ConfigMaps(ctx); return m.Confs[0].Name, err },
+			method: http.MethodGet, path: "/api/v1/configmaps",
+			body: `{"configmaps":{"confs":[{"name":"cm"}]}}`, want: "cm",
+		},
+		{
+			name:   "search",
+			call:   func(c *Client) (any, error) { s, err := c.Search(ctx, "web 10.0", 5); return s.Total, err },
+			method: http.MethodGet, path: "/api/v1/search", query: "limit=5&q=web+10.0",
+			body: `{"query":"web 10.0","total":12,"results":[]}`, want: "12",
+		},
+		{
+			name:   "openapi",
+			call:   func(c *Client) (any, error) { d, err := c.OpenAPI(ctx); return d.OpenAPI, err },
+			method: http.MethodGet, path: "/api/v1/openapi.json",
+			body: `{"openapi":"3.0.3"}`, want: "3.0.3",
+		},
+		{
+			name: "refresh",
+			call: func(c *Client) (any, error) {
+				r, err := c.Refresh(ctx, RefreshOptions{MaxAge: 30 * time.Second, Kinds: []string{"pods", "services"}, Namespace: "default"})
+				return r.Refreshed, err
+			},
+			method: http.MethodPost, path: "/api/v1/refresh", query: "kind=pods%2Cservices&maxAge=30&namespace=default",
+			body: `{"message":"refreshed","refreshed":true}`, want: "true",
+		},
+		{
+			name:   "restart pod",
+			call:   func(c *Client) (any, error) { return nil, c.RestartPod(ctx, "default", "web") },
+			method: http.MethodPost, path: "/api/v1/pods/default/web/restart",
+			body: `{"message":"restarted"}`, want: "<nil>",
+		},
+		{
+			name: "upload kubeconfig",
+			call: func(c *Client) (any, error) {
+				r, err := c.UploadKubeconfig(ctx, []byte("apiVersion: v1"), UploadOptions{Name: "prod"})
+				return r.Message, err
+			},
+			method: http.MethodPost, path: "/api/v1/config",
+			body: `{"message":"connected"}`, want: "connected",
+		},
+		{
+			name: "validate kubeconfig",
+			call: func(c *Client) (any, error) {
+				r, err := c.ValidateKubeconfig(ctx, []byte("apiVersion: v1"))
+				return r.Issues[0].Field, err
+			},
+			method: http.MethodPost, path: "/api/v1/config/validate",
+			body: `{"valid":false,"issues":[{"severity":"error","field":"users[alice].exec"}]}`, want: "users[alice].exec",
+		},
+		{
+			name:   "whoami",
+			call:   func(c *Client) (any, error) { id, err := c.WhoAmI(ctx); return id.User, err },
+			method: http.MethodGet, path: "/api/v1/whoami",
+			body: `{"user":"alice","method":"client-certificate"}`, want: "alice",
+		},
+		{
+			name:   "context",
+			call:   func(c *Client) (any, error) { r, err := c.Context(ctx); return r.CurrentContext, err },
+			method: http.MethodGet, path: "/api/v1/context",
+			body: `{"currentContext":"prod"}`, want: "prod",
+		},
+		{
+			name:   "use context",
+			call:   func(c *Client) (any, error) { r, err := c.UseContext(ctx, "dev", "web"); return r.CurrentContext, err },
+			method: http.MethodPut, path: "/api/v1/context",
+			body: `{"currentContext":"dev"}`, want: "dev",
+		},
+		{
+			name:   "clusters",
+			call:   func(c *Client) (any, error) { r, err := c.Clusters(ctx); return r.Current, err },
+			method: http.MethodGet, path: "/api/v1/clusters",
+			body: `{"current":"prod","clusters":[]}`, want: "prod",
+		},
+		{
+			name: "register cluster",
+			call: func(c *Client) (any, error) {
+				r, err := c.RegisterCluster(ctx, &ClusterRegistration{Name: "dev"})
+				return r.Name, err
+			},
+			method: http.MethodPost, path: "/api/v1/clusters",
+			body: `{"name":"dev"}`, want: "dev",
+		},
+		{
+			name:   "remove cluster",
+			call:   func(c *Client) (any, error) { return nil, c.RemoveCluster(ctx, "dev") },
+			method: http.MethodDelete, path: "/api/v1/clusters/dev",
+			body: `{"message":"removed"}`, want: "<nil>",
+		},
+		{
+			name:   "stored clusters",
+			call:   func(c *Client) (any, error) { r, err := c.StoredClusters(ctx); return len(r.Clusters), err },
+			method: http.MethodGet, path: "/api/v1/stored-clusters",
+			body: `{"clusters":[{"name":"prod"}]}`, want: "1",
+		},
+		{
+			name:   "forget stored cluster",
+			call:   func(c *Client) (any, error) { return nil, c.ForgetStoredCluster(ctx, "prod") },
+			method: http.MethodDelete, path: "/api/v1/stored-clusters/prod",
+			body: `{"message":"forgotten"}`, want: "<nil>",
+		},
+		{
+			name:   "fleet",
+			call:   func(c *Client) (any, error) { r, err := c.Fleet(ctx, "env=prod"); return len(r.Clusters), err },
+			method: http.MethodGet, path: "/api/v1/fleet", query: "selector=env%3Dprod",
+			body: `{"clusters":[{"name":"prod"}]}`, want: "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, tt.body)
+			})
+
+			v, err := tt.call(c)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Method != tt.method {
+				t.Errorf("method = %s, want %s", got.Method, tt.method)
+			}
+			if got.URL.EscapedPath() != tt.path {
+				t.Errorf("path = %s, want %s", got.URL.EscapedPath(), tt.path)
+			}
+			if got.URL.RawQuery != tt.query {
+				t.Errorf("query = %s, want %s", got.URL.RawQuery, tt.query)
+			}
+			if s := fmt.Sprint(v); s != tt.want {
+				t.Errorf("got %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"api error", http.StatusNotFound, `{"error":{"status":404,"message":"node nope not found"}}`, "node nope not found"},
+		{"plain text", http.StatusBadRequest, "invalid limit\n", "invalid limit"},
+		{"forbidden", http.StatusForbidden, `{"error":{"status":403,"message":"pods did not load (forbidden)"}}`, "pods did not load (forbidden)"},
+		{"empty body", http.StatusConflict, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+
+			_, err := c.Overview(context.Background())
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want *Error", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.message {
+				t.Errorf("got %d %q, want %d %q", apiErr.StatusCode, apiErr.Message, tt.status, tt.message)
+			}
+			if !IsStatus(err, tt.status) {
+				t.Errorf("IsStatus(err, %d) = false", tt.status)
+			}
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		io.WriteString(w, `{"error":{"status":422,"message":"kubeconfig rejected"},"validation":{"valid":false,"issues":[`+
+			`{"severity":"error","context":"prod","field":"users[alice].exec","message":"exec plugin not allowed"},`+
+			`{"severity":"warning","context":"prod","field":"users[alice].client-certificate-data","message":"expires in 3 days"}]}}`)
+	})
+
+	_, err := c.UploadKubeconfig(context.Background(), []byte("apiVersion: v1"), UploadOptions{})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Validation == nil {
+		t.Fatalf("error = %#v, want *Error with the validation report", err)
+	}
+	issues := apiErr.Validation.Issues
+	if len(issues) != 2 || issues[0].Field != "users[alice].exec" || issues[1].Severity != "warning" {
+		t.Errorf("issues = %+v", issues)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		auth    string
+		agent   string
+		cluster string
+	}{
+		{"defaults", nil, "", "kubemon-client", ""},
+		{"token", []Option{WithToken("s3cret")}, "Bearer s3cret", "kubemon-client", ""},
+		{"user agent", []Option{WithUserAgent("kubemon")}, "", "kubemon", ""},
+		{"cluster", []Option{WithCluster("prod")}, "", "kubemon-client", "prod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				io.WriteString(w, `{}`)
+			}, tt.opts...)
+
+			if _, err := c.Overview(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if a := got.Header.Get("Authorization"); a != tt.auth {
+				t.Errorf("Authorization = %q, want %q", a, tt.auth)
+			}
+			if ua := got.Header.Get("User-Agent"); ua != tt.agent {
+				t.Errorf("User-Agent = %q, want %q", ua, tt.agent)
+			}
+			if cl := got.URL.Query().Get("cluster"); cl != tt.cluster {
+				t.Errorf("cluster = %q, want %q", cl, tt.cluster)
+			}
+		})
+	}
+}
+
+// writePEM writes der as a pem block of typ to a file in dir
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// clientCert makes a ca and a client certificate for cn signed by it, and
+// writes the client's certificate and key to dir
+func clientCert(t *testing.T, dir, cn string) (ca *x509.Certificate, certFile, keyFile string) {
+	t.Helper()
+	newCert := func(tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert, key
+	}
+
+	ca, caKey := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "kubemon users"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	cert, key := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: cn},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca, writePEM(t, dir, cn+".crt", "CERTIFICATE", cert.Raw), writePEM(t, dir, cn+".key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, certFile, keyFile := clientCert(t, dir, "alice")
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"user":%q,"method":"client-certificate"}`, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	// the handshake without a certificate below fails on purpose
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	serverCA := writePEM(t, dir, "server-ca.crt", "CERTIFICATE", srv.Certificate().Raw)
+
+	c, err := New(srv.URL, WithClientCert(certFile, keyFile), WithServerCA(serverCA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := c.WhoAmI(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.User != "alice" {
+		t.Errorf("user = %s, want alice", id.User)
+	}
+
+	// without the certificate the handshake fails
+	c, err = New(srv.URL, WithRetries(0, 0, 0), WithServerCA(serverCA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.WhoAmI(context.Background()); err == nil {
+		t.Error("request without a client certificate went through")
+	}
+
+	// files that are not there fail New
+	if _, err := New(srv.URL, WithServerCA(filepath.Join(dir, "nope.crt"))); err == nil {
+		t.Error("New with a missing ca file did not fail")
+	}
+	if _, err := New(srv.URL, WithClientCert(filepath.Join(dir, "nope.crt"), keyFile)); err == nil {
+		t.Error("New with a missing certificate file did not fail")
+	}
+	// tls options can not reach into a transport of the caller's
+	if _, err := New(srv.URL, WithHTTPClient(&http.Client{Transport: &http.Transport{}}), WithClientCert(certFile, keyFile)); err == nil {
+		t.Error("New with tls options and a custom transport did not fail")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // answers in order, the last one repeats
+		call     func(c *Client) error
+		attempts int32
+		ok       bool
+	}{
+		{"recovers after 503", []int{503, 503, 200}, getOverview, 3, true},
+		{"retries 429", []int{429, 200}, getOverview, 2, true},
+		{"gives up after the retries", []int{500}, getOverview, 3, false},
+		{"no retry on 404", []int{404}, getOverview, 1, false},
+		{"no retry for posts", []int{503}, func(c *Client) error { return c.RestartPod(context.Background(), "default", "web") }, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n atomic.Int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				i := int(n.Add(1)) - 1
+				status := tt.statuses[min(i, len(tt.statuses)-1)]
+				w.WriteHeader(status)
+				io.WriteString(w, `{}`)
+			})
+
+			err := tt.call(c)
+			if (err == nil) != tt.ok {
+				t.Errorf("error = %v, want ok %v", err, tt.ok)
+			}
+			if got := n.Load(); got != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func getOverview(c *Client) error {
+	_, err := c.Overview(context.Background())
+	return err
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestStreamLogs(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  LogOptions
+		query string
+		lines []string
+	}{
+		{"all", LogOptions{}, "", []string{"one", "two", "three"}},
+		{"tail", LogOptions{Container: "app", TailLines: 2}, "container=app&tail=2", []string{"two", "three"}},
+		{"follow", LogOptions{Follow: true}, "follow=true", []string{"one"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, strings.Join(tt.lines, "\n")+"\n")
+			})
+
+			var lines []string
+			err := c.StreamLogs(context.Background(), "default", "web", tt.opts, func(line string) error {
+				lines = append(lines, line)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.URL.Path != "/api/v1/pods/default/web/logs" {
+				t.Errorf("path = %s", got.URL.Path)
+			}
+			if got.URL.RawQuery != tt.query {
+				t.Errorf("query = %s, want %s", got.URL.RawQuery, tt.query)
+			}
+			if strings.Join(lines, ",") != strings.Join(tt.lines, ",") {
+				t.Errorf("lines = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestStreamLogsStops(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		for i := 0; ; i++ {
+			if _, err := fmt.Fprintf(w, "line %d\n", i); err != nil {
+				return
+			}
+			flusher.Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	})
+
+	stop := errors.New("seen enough")
+	var n int
+	err := c.StreamLogs(context.Background(), "default", "web", LogOptions{Follow: true}, func(string) error {
+		if n++; n == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("error = %v, want the callback's", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = c.StreamLogs(ctx, "default", "web", LogOptions{Follow: true}, func(string) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want the deadline", err)
+	}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type LogOptions struct {
+	Container string
+	Follow    bool
+	TailLines int64
+}
+
+// Logs opens the log stream of a pod, the caller closes it. with Follow the
+// stream stays open until ctx is cancelled or the pod goes away
+func (c *Client) Logs(ctx context.Context, namespace, name string, opts LogOptions) (io.ReadCloser, error) {
+	q := url.Values{}
+	if opts.Container != "" {
+		q.Set("container", opts.Container)
+	}
+	if opts.Follow {
+		q.Set("follow", "true")
+	}
+	if opts.TailLines > 0 {
+		q.Set("tail", strconv.FormatInt(opts.TailLines, 10))
+	}
+
+	path := fmt.Sprintf("/pods/%s/%s/logs", url.PathEscape(namespace), url.PathEscape(name))
+	res, err := c.send(ctx, &request{method: http.MethodGet, path: path, query: q})
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// StreamLogs calls fn with every log line until the stream ends, ctx is
+// cancelled or fn returns an error
+func (c *Client) StreamLogs(ctx context.Context, namespace, name string, opts LogOptions, fn func(line string) error) error {
+	stream, err := c.Logs(ctx, namespace, name, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	sc := bufio.NewScanner(stream)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if err := fn(sc.Text()); err != nil {
+			return err
+		}
+	}
+
+	if err := sc.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return ctx.Err()
+}
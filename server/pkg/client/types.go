@@ -0,0 +1,70 @@
+package client
+
+import "server/internal/server"
+
+// the response types are the server's own, aliased so code outside this
+// module can name them
+
+type (
+	Overview         = server.OverviewResponse
+	NodeCounts       = server.NodeCounts
+	Pods             = server.Pods
+	PodsInfo         = server.PodsInfo
+	Container        = server.Container
+	ContainerState   = server.ContainerState
+	Owner            = server.Owner
+	Port             = server.Port
+	Nodes            = server.Nodes
+	Nodesinfo        = server.Nodesinfo
+	NodeCondition    = server.NodeCondition
+	Taint            = server.Taint
+	NodePods         = server.NodePodsResponse
+	Services         = server.Services
+	ServiceInfo      = server.ServiceInfo
+	ServiceEndpoints = server.ServiceEndpoints
+	Endpoint         = server.Endpoint
+	Ingress          = server.Ingress
+	IngressInfo      = server.IngressInfo
+	Rule             = server.Rule
+	Path             = server.Path
+	Backend          = server.Backend
+	NameSpace        = server.NameSpace
+	Secrets          = server.Secrets
+	SecretsInfo      = server.SecretsInfo
+	ConfigMaps       = server.ConfigMaps
+	ConfigMapInfo    = server.ConfigMapInfo
+	SearchResponse   = server.SearchResponse
+	SearchResult     = server.SearchResult
+	OpenAPIDoc       = server.OpenAPIDoc
+
+	Resources          = server.Resources
+	NamespaceResources = server.NamespaceResources
+	NodeAllocation     = server.NodeAllocation
+	Allocations        = server.Allocations
+	Percentages        = server.Percentages
+
+	CollectorStatus = server.CollectorStatus
+	Access          = server.Access
+
+	KubeconfigResponse = server.KubeconfigResponse
+	KubeconfigContext  = server.KubeconfigContext
+	ValidationReport   = server.ValidationReport
+	ValidationIssue    = server.ValidationIssue
+	ClientCertificate  = server.ClientCertificate
+
+	Identity = server.Identity
+
+	ClusterRegistration = server.ClusterRegistration
+	ClusterInfo         = server.ClusterInfo
+	ClustersResponse    = server.ClustersResponse
+	RefreshStatus       = server.RefreshStatus
+	RefreshResponse     = server.RefreshResponse
+	BreakerStatus       = server.BreakerStatus
+	FleetResponse       = server.FleetResponse
+	FleetCluster        = server.FleetCluster
+	FleetTotals         = server.FleetTotals
+	PodCounts           = server.PodCounts
+
+	StoredCluster          = server.StoredCluster
+	StoredClustersResponse = server.StoredClustersResponse
+)
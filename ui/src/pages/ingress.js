@@ -300,10 +300,10 @@ function Ingress(){
                                                   <circle cx="12" cy="12" r="3"/>
                                                   <circle cx="12" cy="12" r="10"/>
                                                 </svg> */}
-                                                <span>{path.backend.name}</span>
+                                                <span>{path.backend ? path.backend.name : "-"}</span>
                                               </div>
                                               <span className="ingress-backend-port">
-                                                Port: {path.backend.ports}
+                                                Port: {path.backend ? path.backend.ports : "-"}
                                               </span>
                                             </div>
                                           </div>
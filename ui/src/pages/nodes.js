@@ -224,6 +224,10 @@ function Nodes() {
                       <span className={`status-badge ${node.status === "yay" ? "ready" : "not-ready"}`}>
                         {node.status}
                       </span>
+                      {node.unschedulable && <span className="status-badge not-ready">SchedulingDisabled</span>}
+                      {(node.pressure || []).map((p) => (
+                        <span key={p} className="status-badge not-ready" title={p}>{p}</span>
+                      ))}
                     </td>
                     <td>
                       <span className="roles-badge">{node.roles || "<none>"}</span>
@@ -299,7 +299,7 @@ function Pods(){
                       </td>
                       <td>
                         <span className={`status-badge ${pod.status === "yay" ? "ready" : "not-ready"}`}>
-                          {pod.status}
+                          {pod.kubectlstatus || pod.status}
                         </span>
                       </td>
                       <td className="ns-cell">{pod.namespace}</td>
@@ -203,6 +203,7 @@ function Services(){
                   <th>ExternalIP</th>
                   <th>Ports</th>
                   <th>Selector</th>
+                  <th>Endpoints</th>
                 </tr>
               </thead>
               <tbody>
@@ -239,7 +240,7 @@ function Services(){
                         {service.ports && service.ports.length > 0 ? (
                           service.ports.map((port, portIndex) => (
                             <span key={portIndex} className="services-port-badge">
-                              {port.port}:{port.targetport}/{port.protocol}
+                              {port.port}:{port.targetport || port.targetportname}/{port.protocol}
                             </span>
                           ))
                         ) : (
@@ -260,6 +261,18 @@ function Services(){
                         <span className="services-no-selector">-</span>
                       )}
                     </td>
+                    <td className="services-endpoints-cell">
+                      {service.endpoints ? (
+                        <span
+                          className={`status-badge ${service.endpoints.ready > 0 ? "ready" : "not-ready"}`}
+                          title={(service.pods || []).join(", ")}
+                        >
+                          {service.endpoints.ready}/{service.endpoints.ready + service.endpoints.notready}
+                        </span>
+                      ) : (
+                        <span className="services-no-selector">-</span>
+                      )}
+                    </td>
                   </tr>
                 ))}
               </tbody>